@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"parser/gamedb"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 场景地图工具
+// render : 将map_*.json渲染为PNG,对比编辑器导出结果.
+// convert : 将map_*.json转换为二进制缓存(map_*.bin),启动时json未变化则直接加载二进制.
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "render":
+		err = render(os.Args[2:])
+	case "convert":
+		err = convert(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Printf("scenetool %s err : %s\n", os.Args[1], err.Error())
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("usage : scenetool <command> [flags]")
+	fmt.Println("commands :")
+	fmt.Println("  render   render a scene map to PNG")
+	fmt.Println("  convert  convert scene map json to binary cache")
+}
+
+func render(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	mapPath := flags.String("map", "", "scene map json file (map_*.json)")
+	out := flags.String("out", "", "output png file, default <map>.png")
+	scale := flags.Float64("scale", 0.25, "pixel scale, 1 means CellWidth*CellHeight pixels per cell")
+	layers := flags.Int("layers", 0xfe, "road flag layers to color (bit mask, bit0 walkable is always drawn)")
+	grid := flags.Bool("grid", false, "draw cell grid lines")
+	path := flags.String("path", "", "overlay path cells, e.g. \"1,2;3,4;5,6\"")
+	points := flags.String("points", "", "overlay points, e.g. \"1,2;3,4\"")
+	find := flags.String("find", "", "find and overlay a path between two cells, e.g. \"1,2;30,40\"")
+	flags.Parse(args)
+
+	if len(*mapPath) == 0 {
+		flags.Usage()
+		return fmt.Errorf("-map is required")
+	}
+
+	sceneMap, err := gamedb.LoadSceneMap(*mapPath, 0)
+	if err != nil {
+		return err
+	}
+
+	opts := gamedb.RenderOptions{
+		Scale:  *scale,
+		Layers: gamedb.RoadFlag(*layers) &^ gamedb.FlagWalkable,
+		Grid:   *grid,
+	}
+
+	if opts.Path, err = parsePoints(*path); err != nil {
+		return err
+	}
+	if opts.Points, err = parsePoints(*points); err != nil {
+		return err
+	}
+
+	if len(*find) > 0 {
+		ends, err := parsePoints(*find)
+		if err != nil {
+			return err
+		}
+		if len(ends) != 2 {
+			return fmt.Errorf("-find needs exactly 2 points")
+		}
+		if opts.Path, err = sceneMap.FindPath(ends[0], ends[1], gamedb.PathOptions{Diagonal: true}); err != nil {
+			return err
+		}
+		fmt.Printf("path found, %d cells\n", len(opts.Path))
+	}
+
+	if len(*out) == 0 {
+		*out = strings.TrimSuffix(*mapPath, ".json") + ".png"
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := sceneMap.RenderPNG(f, opts); err != nil {
+		return err
+	}
+
+	fmt.Printf("map %d (%d x %d cells) rendered to %s\n", sceneMap.Id, sceneMap.Width, sceneMap.Height, *out)
+	return nil
+}
+
+func convert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	dir := flags.String("dir", "", "scenes directory, convert every map_*.json in it")
+	mapPath := flags.String("map", "", "single scene map json file")
+	check := flags.Bool("check", false, "only check binary files are up to date, do not write")
+	flags.Parse(args)
+
+	var files []string
+	if len(*mapPath) > 0 {
+		files = append(files, *mapPath)
+	}
+	if len(*dir) > 0 {
+		matches, err := filepath.Glob(filepath.Join(*dir, "map_*.json"))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		flags.Usage()
+		return fmt.Errorf("-dir or -map is required")
+	}
+
+	var stale int
+	for _, file := range files {
+		if *check {
+			ok, err := gamedb.SceneBinaryUpToDate(file)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				stale++
+				fmt.Printf("%s binary out of date\n", file)
+			}
+			continue
+		}
+
+		var sceneId int
+		fmt.Sscanf(filepath.Base(file), "map_%d.json", &sceneId)
+		sceneMap, err := gamedb.ConvertSceneMap(file, "", sceneId)
+		if err != nil {
+			return fmt.Errorf("%s : %w", file, err)
+		}
+		fmt.Printf("%s converted, map %d (%d x %d cells)\n", file, sceneMap.Id, sceneMap.Width, sceneMap.Height)
+	}
+
+	if stale > 0 {
+		return fmt.Errorf("%d scene binaries out of date", stale)
+	}
+	return nil
+}
+
+// "x,y;x,y" -> []Point
+func parsePoints(str string) ([]gamedb.Point, error) {
+	var points []gamedb.Point
+	for _, elem := range strings.Split(strings.TrimSpace(str), ";") {
+		if len(elem) == 0 {
+			continue
+		}
+		xy := strings.Split(elem, ",")
+		if len(xy) != 2 {
+			return nil, fmt.Errorf("invalid point %s", elem)
+		}
+		x, err := strconv.Atoi(strings.TrimSpace(xy[0]))
+		if err != nil {
+			return nil, err
+		}
+		y, err := strconv.Atoi(strings.TrimSpace(xy[1]))
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, gamedb.Point{X: x, Y: y})
+	}
+	return points, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"parser/gamedb"
+	"path/filepath"
+	"strings"
+)
+
+// 表格工具
+// export : 将注册的xlsx sheet导出为文本镜像(csv),用于review表格修改.
+// import : 将文本镜像写回xlsx.
+// check  : 检查文本镜像与xlsx是否一致(CI中使用).
+// gen    : 根据表头(标题行,类型行,注释行)生成行结构体,表格注册和GameDB field.
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "import":
+		err = importMirror(os.Args[2:])
+	case "check":
+		err = check(os.Args[2:])
+	case "gen":
+		err = gen(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Printf("sheettool %s err : %s\n", os.Args[1], err.Error())
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("usage : sheettool <command> [flags]")
+	fmt.Println("commands :")
+	fmt.Println("  export  export registered xlsx sheets to text mirror")
+	fmt.Println("  import  write text mirror back to xlsx")
+	fmt.Println("  check   check text mirror is in sync with xlsx")
+	fmt.Println("  gen     generate row structs, registry and GameDB fields from sheet headers")
+}
+
+// -dir为gamedb目录(包含excels/), -mirror默认为<dir>/mirror
+func mirrorFlags(name string, args []string) (string, string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	dir := flags.String("dir", ".", "gamedb directory which contains excels/")
+	mirror := flags.String("mirror", "", "text mirror directory, default <dir>/mirror")
+	flags.Parse(args)
+
+	if len(*mirror) == 0 {
+		*mirror = filepath.Join(*dir, "mirror")
+	}
+	return filepath.Join(*dir, "excels"), *mirror
+}
+
+func export(args []string) error {
+	excelDir, mirrorDir := mirrorFlags("export", args)
+	files, err := gamedb.ExportMirror(excelDir, mirrorDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Printf("%s exported\n", file)
+	}
+	return nil
+}
+
+func importMirror(args []string) error {
+	excelDir, mirrorDir := mirrorFlags("import", args)
+	files, err := gamedb.ImportMirror(mirrorDir, excelDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Printf("%s updated\n", file)
+	}
+	return nil
+}
+
+func check(args []string) error {
+	excelDir, mirrorDir := mirrorFlags("check", args)
+	stale, err := gamedb.CheckMirror(excelDir, mirrorDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range stale {
+		fmt.Printf("%s out of sync, run sheettool export or import\n", file)
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("%d mirror files out of sync", len(stale))
+	}
+	fmt.Println("mirror in sync")
+	return nil
+}
+
+// -add可重复, 格式为excel:sheet:Field[:Key], 没有Key时为slice
+type addFlags []gamedb.GenSheet
+
+func (adds *addFlags) String() string {
+	return fmt.Sprint(*adds)
+}
+
+func (adds *addFlags) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return fmt.Errorf("%q should be excel:sheet:Field[:Key]", value)
+	}
+	sheet := gamedb.GenSheet{ExcelName: parts[0], SheetName: parts[1], Field: parts[2]}
+	if len(parts) == 4 {
+		sheet.Key = parts[3]
+	}
+	*adds = append(*adds, sheet)
+	return nil
+}
+
+// -src为gamedb源码目录
+func gen(args []string) error {
+	var adds addFlags
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	dir := flags.String("dir", ".", "gamedb directory which contains excels/")
+	src := flags.String("src", "gamedb", "gamedb source directory")
+	flags.Var(&adds, "add", "register a new sheet, excel:sheet:Field[:Key] (repeatable)")
+	flags.Parse(args)
+
+	files, err := gamedb.GenerateCode(gamedb.GenOptions{
+		ExcelDir:  filepath.Join(*dir, "excels"),
+		SourceDir: *src,
+		Add:       adds,
+	})
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Printf("%s generated\n", file)
+	}
+	if len(files) == 0 {
+		fmt.Println("sources up to date")
+	}
+	return nil
+}
@@ -0,0 +1,750 @@
+package gamedb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 代码生成: 读取注册表格的标题行(以及类型行和注释行), 生成行结构体, 表格注册和GameDB field.
+// 结构体在声明所在的文件中原地替换, 文件中的其他声明(手写的方法等)保留;
+// 表格注册(excels.go)和GameDB field(gamedb.go)在标记区域内重新生成.
+// 已有field按col tag对应: 列改名后生成新的field, 类型与类型行一致(或没有类型行)时保留原有的类型,tag和注释.
+
+const (
+	genRegistryMarker = "sheettool gen registry" // excels.go DefaultRegistry中的标记区域
+	genFieldsMarker   = "sheettool gen fields"   // gamedb.go GameDB中的标记区域
+	genNewTypesFile   = "objs.go"                // 新增结构体写入的文件
+)
+
+// 新增的sheet
+type GenSheet struct {
+	ExcelName string
+	SheetName string
+	Field     string // GameDB field
+	Key       string // map的key field, 为空时为slice
+}
+
+type GenOptions struct {
+	ExcelDir  string     // 表格目录
+	SourceDir string     // gamedb源码目录
+	Add       []GenSheet // 新增的sheet, 结构体名为sheet名(首字母大写)
+}
+
+// 生成代码的sheet
+type genTable struct {
+	excelName string
+	sheetName string
+	typeName  string
+	field     string
+	key       string
+	objT      reflect.Type // 已注册的结构体, 新增的sheet为nil
+
+	title   []string
+	types   []string // 类型行, 没有时为nil
+	comment []string // 注释行, 没有时为nil
+	fields  []genField
+}
+
+type genField struct {
+	name    string
+	typ     string // 类型源码
+	tag     string // 不含反引号
+	comment string
+}
+
+// 生成代码, 返回修改的文件
+func GenerateCode(opts GenOptions) ([]string, error) {
+	sources, err := parseSources(opts.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := sources.file("excels.go")
+	if nil == registry {
+		return nil, fmt.Errorf("excels.go not found in %s", opts.SourceDir)
+	}
+	tables, err := genTables(opts, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range tables {
+		if err := table.readHeader(opts.ExcelDir); err != nil {
+			return nil, err
+		}
+	}
+
+	// 结构体
+	var newTypes bytes.Buffer
+	for _, table := range tables {
+		source, structType := sources.findStruct(table.typeName)
+		if err := table.buildFields(source, structType); err != nil {
+			return nil, err
+		}
+		text := table.structSource()
+		if nil == source {
+			fmt.Fprintf(&newTypes, "\n// %s (%s)\ntype %s %s\n", table.sheetName, table.excelName, table.typeName, text)
+			continue
+		}
+		source.replace(structType.Pos(), structType.End(), text)
+	}
+
+	if newTypes.Len() > 0 {
+		source := sources.file(genNewTypesFile)
+		if nil == source {
+			return nil, fmt.Errorf("%s not found in %s", genNewTypesFile, opts.SourceDir)
+		}
+		source.appendText(newTypes.String())
+	}
+
+	// 表格注册和GameDB field
+	if err := registry.replaceRegion(genRegistryMarker, registrySource(tables)); err != nil {
+		return nil, err
+	}
+
+	gamedb := sources.file("gamedb.go")
+	if nil == gamedb {
+		return nil, fmt.Errorf("gamedb.go not found in %s", opts.SourceDir)
+	}
+	_, gameDBType := sources.findStruct("GameDB")
+	if err := gamedb.replaceRegion(genFieldsMarker, gameDBFieldsSource(tables, gamedb, gameDBType)); err != nil {
+		return nil, err
+	}
+
+	return sources.write()
+}
+
+// 标记区域中注册的sheet(按源码, 编译后的注册表可能不是最新的), 区域外自定义loader的sheet(只生成结构体)和新增的sheet.
+// 编译后注册表中存在的结构体用于检查已有field的类型和多列字段.
+func genTables(opts GenOptions, registry *genSource) ([]*genTable, error) {
+	objTypes := make(map[string]reflect.Type)
+	var custom []*genTable
+	for _, excelInfo := range DefaultRegistry().files {
+		for _, info := range excelInfo.sheetInfos {
+			objT := reflect.TypeOf(info.obj).Elem()
+			objTypes[objT.Name()] = objT
+			if len(info.field) == 0 {
+				custom = append(custom, &genTable{
+					excelName: excelInfo.excelName,
+					sheetName: info.sheetName,
+					typeName:  objT.Name(),
+					objT:      objT,
+				})
+			}
+		}
+	}
+
+	tables, err := registry.registeredTables()
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		table.objT = objTypes[table.typeName]
+	}
+	tables = append(tables, custom...)
+
+	registered := make(map[string]bool)
+	for _, table := range tables {
+		registered[table.excelName+"/"+table.sheetName] = true
+	}
+
+	for _, sheet := range opts.Add {
+		if registered[sheet.ExcelName+"/"+sheet.SheetName] {
+			return nil, fmt.Errorf("%s sheet ( %s ) already registered", sheet.ExcelName, sheet.SheetName)
+		}
+		if len(sheet.Field) == 0 {
+			return nil, fmt.Errorf("%s sheet ( %s ) needs a GameDB field", sheet.ExcelName, sheet.SheetName)
+		}
+		tables = append(tables, &genTable{
+			excelName: sheet.ExcelName,
+			sheetName: sheet.SheetName,
+			typeName:  exportName(sheet.SheetName),
+			field:     sheet.Field,
+			key:       sheet.Key,
+		})
+		registered[sheet.ExcelName+"/"+sheet.SheetName] = true
+	}
+	return tables, nil
+}
+
+var (
+	genRegisterRe   = regexp.MustCompile(`registry\.register\("([^"]+)"`)
+	genMapSheetRe   = regexp.MustCompile(`mapSheet\("([^"]+)", &(\w+)\{\}, "(\w+)", "(\w+)"\)`)
+	genArraySheetRe = regexp.MustCompile(`arraySheet\("([^"]+)", &(\w+)\{\}, "(\w+)"\)`)
+)
+
+// 解析标记区域中的registry.register调用(由registrySource生成, 每行一个调用或sheet)
+func (source *genSource) registeredTables() ([]*genTable, error) {
+	start, end, err := source.region(genRegistryMarker)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*genTable
+	excelName := ""
+	for _, line := range strings.Split(string(source.src[start:end]), "\n") {
+		if match := genRegisterRe.FindStringSubmatch(line); match != nil {
+			excelName = match[1]
+		} else if match := genMapSheetRe.FindStringSubmatch(line); match != nil {
+			tables = append(tables, &genTable{excelName: excelName, sheetName: match[1], typeName: match[2], field: match[3], key: match[4]})
+		} else if match := genArraySheetRe.FindStringSubmatch(line); match != nil {
+			tables = append(tables, &genTable{excelName: excelName, sheetName: match[1], typeName: match[2], field: match[3]})
+		} else if trimmed := strings.TrimSpace(line); len(trimmed) > 0 && trimmed != ")" {
+			return nil, fmt.Errorf("%s : unexpected line %q in %s region", source.path, trimmed, genRegistryMarker)
+		}
+	}
+	return tables, nil
+}
+
+// 读取标题行, 类型行和注释行(类型行的上一行, 没有类型行时为标题行的上一行)
+func (table *genTable) readHeader(excelDir string) error {
+	book, err := openWorkbook(context.Background(), filepath.Join(excelDir, table.excelName))
+	if err != nil {
+		return err
+	}
+	defer book.close()
+
+	rows, err := book.rows(table.sheetName)
+	if err != nil {
+		return fmt.Errorf("%s : %w", table.excelName, err)
+	}
+	defer rows.close() // 只读取到标题行
+
+	header := make([][]string, defaultStartRow)
+	for {
+		i, row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s : %w", table.excelName, err)
+		}
+		if i >= defaultStartRow {
+			break
+		}
+		header[i] = row
+	}
+
+	table.title = header[defaultStartRow-1]
+	if len(table.title) <= defaultStartCol {
+		return fmt.Errorf("%s sheet ( %s ) title row ( %d ) not found", table.excelName, table.sheetName, defaultStartRow)
+	}
+
+	commentRow := defaultStartRow - 2
+	if commentRow >= 0 && isTypeRow(header[commentRow], defaultStartCol) {
+		table.types = header[commentRow]
+		commentRow--
+	}
+	if commentRow >= 0 {
+		table.comment = header[commentRow]
+	}
+	return nil
+}
+
+// 按列生成field, 已有的field按col tag对应
+func (table *genTable) buildFields(source *genSource, structType *ast.StructType) error {
+	existing := make(map[string]genField) // key为col
+	var kept []genField                   // 多列字段和不对应列的field
+	var groups []reflect.StructField
+
+	if structType != nil {
+		for _, field := range structType.Fields.List {
+			if len(field.Names) != 1 {
+				continue
+			}
+			info := genField{
+				name: field.Names[0].Name,
+				typ:  source.text(field.Type.Pos(), field.Type.End()),
+			}
+			if field.Tag != nil {
+				info.tag, _ = strconv.Unquote(field.Tag.Value)
+			}
+			if field.Comment != nil {
+				info.comment = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(field.Comment.List[0].Text), "//"))
+			}
+
+			tag := reflect.StructTag(info.tag)
+			if col := tag.Get("col"); len(col) > 0 {
+				existing[col] = info
+				continue
+			}
+			kept = append(kept, info)
+			if table.objT != nil && len(tag.Get("group")) > 0 {
+				if sf, ok := table.objT.FieldByName(info.name); ok {
+					groups = append(groups, sf)
+				}
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for j := defaultStartCol - 1; j < len(table.title); j++ {
+		col := strings.TrimSpace(table.title[j])
+		if len(col) == 0 {
+			break // 与collectColumnInfo一致,第一个空标题之后的列不解析
+		}
+		if seen[col] || matchesGroup(groups, col) {
+			continue
+		}
+		seen[col] = true
+
+		annotation := cellAt(table.types, j)
+		comment := strings.Join(strings.Fields(cellAt(table.comment, j)), " ")
+
+		field, ok := existing[col]
+		if !ok || !table.compatible(field, annotation) {
+			typ, extra, err := annotationSource(annotation)
+			if err != nil {
+				return fmt.Errorf("%s sheet ( %s ) column %s : %w", table.excelName, table.sheetName, col, err)
+			}
+			name := exportName(col)
+			tag := fmt.Sprintf(`col:"%s" client:"%s"`, col, col)
+			if ok {
+				name = field.name
+				if _, client := reflect.StructTag(field.tag).Lookup("client"); !client {
+					tag = fmt.Sprintf(`col:"%s"`, col)
+				}
+			}
+			if len(extra) > 0 {
+				tag += " " + extra
+			}
+			field = genField{name: name, typ: typ, tag: tag, comment: field.comment}
+		}
+		if len(comment) > 0 {
+			field.comment = comment
+		}
+		table.fields = append(table.fields, field)
+	}
+
+	table.fields = append(table.fields, kept...)
+	return nil
+}
+
+// 已有field的类型是否符合类型行(没有类型标注时保留)
+func (table *genTable) compatible(field genField, annotation string) bool {
+	if len(annotation) == 0 {
+		return true
+	}
+	if nil == table.objT || !isAnnotation(annotation) {
+		return false
+	}
+	sf, ok := table.objT.FieldByName(field.name)
+	if !ok {
+		return false
+	}
+	_, err := checkAnnotation(annotation, &fieldInfo{field: &sf, elem: -1, sub: -1})
+	return nil == err
+}
+
+func matchesGroup(groups []reflect.StructField, col string) bool {
+	for _, field := range groups {
+		if _, _, ok := matchGroup(field, col); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (table *genTable) structSource() string {
+	var buf bytes.Buffer
+	buf.WriteString("struct {\n")
+	for _, field := range table.fields {
+		fmt.Fprintf(&buf, "\t%s %s", field.name, field.typ)
+		if len(field.tag) > 0 {
+			fmt.Fprintf(&buf, " `%s`", field.tag)
+		}
+		if len(field.comment) > 0 {
+			fmt.Fprintf(&buf, " //%s", field.comment)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// 每层分隔符: 基础类型元素 / 自带Decoder的元素(元素内部使用逗号)
+var genBasicSeps = []string{COMMA, SEMICOLON + COMMA, PIPE + SEMICOLON + COMMA}
+var genNamedSeps = []string{SEMICOLON, PIPE + SEMICOLON}
+
+var genBasicTypes = map[string]string{
+	"int":      "int",
+	"uint":     "uint",
+	"float":    "float64",
+	"bool":     "bool",
+	"string":   "string",
+	"datetime": "time.Time",
+	"duration": "time.Duration",
+}
+
+// 类型标注对应的Go类型源码和额外的tag, 没有类型标注时为string
+func annotationSource(annotation string) (string, string, error) {
+	if len(annotation) == 0 {
+		return "string", "", nil
+	}
+	if !isAnnotation(annotation) {
+		return "", "", fmt.Errorf("unknown type %q in type row", annotation)
+	}
+
+	if strings.HasPrefix(annotation, annotationRef) {
+		return "int", "", nil
+	}
+
+	base := strings.TrimRight(annotation, "[]")
+	depth := (len(annotation) - len(base)) / 2
+
+	typ, basic := genBasicTypes[base]
+	if !basic {
+		typ = base
+	}
+	if 0 == depth {
+		return typ, "", nil
+	}
+
+	seps := genBasicSeps
+	if !basic {
+		seps = genNamedSeps
+	}
+	if depth > len(seps) {
+		return "", "", fmt.Errorf("type %q nested too deep", annotation)
+	}
+	return strings.Repeat("[]", depth) + typ, fmt.Sprintf(`sep:"%s"`, seps[depth-1]), nil
+}
+
+// 列名转为导出的field名, e.g : itemLvl -> ItemLvl, drop_id -> DropId
+func exportName(name string) string {
+	var buf strings.Builder
+	upper := true
+	for _, r := range name {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func registrySource(tables []*genTable) string {
+	var buf bytes.Buffer
+	var order []string
+	sheets := make(map[string][]*genTable)
+	for _, table := range tables {
+		if len(table.field) == 0 {
+			continue // 自定义loader在标记区域外注册
+		}
+		if _, ok := sheets[table.excelName]; !ok {
+			order = append(order, table.excelName)
+		}
+		sheets[table.excelName] = append(sheets[table.excelName], table)
+	}
+
+	for _, excelName := range order {
+		fmt.Fprintf(&buf, "registry.register(%q,\n", excelName)
+		for _, table := range sheets[excelName] {
+			if len(table.key) > 0 {
+				fmt.Fprintf(&buf, "\tmapSheet(%q, &%s{}, %q, %q),\n", table.sheetName, table.typeName, table.field, table.key)
+			} else {
+				fmt.Fprintf(&buf, "\tarraySheet(%q, &%s{}, %q),\n", table.sheetName, table.typeName, table.field)
+			}
+		}
+		buf.WriteString(")\n")
+	}
+	return buf.String()
+}
+
+// 已有的GameDB field保留原来的声明
+func gameDBFieldsSource(tables []*genTable, source *genSource, gameDBType *ast.StructType) string {
+	existing := make(map[string]string)
+	if gameDBType != nil {
+		for _, field := range gameDBType.Fields.List {
+			if len(field.Names) != 1 {
+				continue
+			}
+			end := field.End()
+			if field.Comment != nil {
+				end = field.Comment.End()
+			}
+			existing[field.Names[0].Name] = source.text(field.Pos(), end)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, table := range tables {
+		if len(table.field) == 0 {
+			continue
+		}
+		if text, ok := existing[table.field]; ok {
+			buf.WriteString(text + "\n")
+			continue
+		}
+
+		client := strings.ToLower(table.field[:1]) + table.field[1:]
+		if len(table.key) > 0 {
+			fmt.Fprintf(&buf, "%s map[%s]*%s `client:\"%s,map\" mapKey:\"%s\"`\n", table.field, table.keyType(), table.typeName, client, table.key)
+		} else {
+			fmt.Fprintf(&buf, "%s []*%s `client:\"%s,array\"`\n", table.field, table.typeName, client)
+		}
+	}
+	return buf.String()
+}
+
+// map key field的类型, 默认为int
+func (table *genTable) keyType() string {
+	for _, field := range table.fields {
+		if field.name == table.key {
+			return field.typ
+		}
+	}
+	return "int"
+}
+
+// 源码文件及待写入的修改
+type genSource struct {
+	path string
+	fset *token.FileSet
+	file *ast.File
+	src  []byte
+	out  []byte // 修改后的源码
+
+	edits []genEdit
+	tail  string
+}
+
+type genEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+type genSources []*genSource
+
+func parseSources(dir string) (genSources, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sources genSources
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, &genSource{path: path, fset: fset, file: file, src: src})
+	}
+	return sources, nil
+}
+
+func (sources genSources) file(name string) *genSource {
+	for _, source := range sources {
+		if filepath.Base(source.path) == name {
+			return source
+		}
+	}
+	return nil
+}
+
+func (sources genSources) findStruct(typeName string) (*genSource, *ast.StructType) {
+	for _, source := range sources {
+		for _, decl := range source.file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				if structType, ok := typeSpec.Type.(*ast.StructType); ok && typeSpec.Name.Name == typeName {
+					return source, structType
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (source *genSource) offset(pos token.Pos) int {
+	return source.fset.Position(pos).Offset
+}
+
+func (source *genSource) text(start, end token.Pos) string {
+	return string(source.src[source.offset(start):source.offset(end)])
+}
+
+func (source *genSource) replace(start, end token.Pos, text string) {
+	source.edits = append(source.edits, genEdit{source.offset(start), source.offset(end), text})
+}
+
+func (source *genSource) appendText(text string) {
+	source.tail += text
+}
+
+// "// <marker> begin"和"// <marker> end"两行之间的内容
+func (source *genSource) region(marker string) (int, int, error) {
+	begin := bytes.Index(source.src, []byte("// "+marker+" begin"))
+	end := bytes.Index(source.src, []byte("// "+marker+" end"))
+	if begin < 0 || end < begin {
+		return 0, 0, fmt.Errorf("%s : marker %q not found", source.path, marker)
+	}
+	start := begin + bytes.IndexByte(source.src[begin:], '\n') + 1
+	end = bytes.LastIndexByte(source.src[:end], '\n') + 1
+	return start, end, nil
+}
+
+func (source *genSource) replaceRegion(marker string, text string) error {
+	start, end, err := source.region(marker)
+	if err != nil {
+		return err
+	}
+	source.edits = append(source.edits, genEdit{start, end, text})
+	return nil
+}
+
+// 应用修改并格式化, 返回是否有变化
+func (source *genSource) apply() (bool, error) {
+	sort.Slice(source.edits, func(i, j int) bool {
+		return source.edits[i].start > source.edits[j].start
+	})
+
+	out := append([]byte(nil), source.src...)
+	for _, edit := range source.edits {
+		out = append(out[:edit.start], append([]byte(edit.text), out[edit.end:]...)...)
+	}
+	out = append(out, source.tail...)
+	out = ensureImport(out, "time")
+
+	formatted, err := format.Source(out)
+	if err != nil {
+		return false, fmt.Errorf("%s : %w", source.path, err)
+	}
+	source.out = formatted
+	return !bytes.Equal(formatted, source.src), nil
+}
+
+func (sources genSources) write() ([]string, error) {
+	var written []string
+	for _, source := range sources {
+		if len(source.edits) == 0 && len(source.tail) == 0 {
+			continue
+		}
+		changed, err := source.apply()
+		if err != nil {
+			return written, err
+		}
+		if !changed {
+			continue
+		}
+		if err := ioutil.WriteFile(source.path, source.out, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, source.path)
+	}
+	return written, nil
+}
+
+// 源码使用了pkg(pkg.X形式的选择器,且pkg不是本文件声明的标识符)但没有导入时添加import, 已有import块时合并到块中;
+// 不再使用时(e.g : 删除了datetime列)去除import
+func ensureImport(src []byte, pkg string) []byte {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return src // 由format.Source报告语法错误
+	}
+	used := usesPackage(file, pkg)
+
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+	splice := func(start, end int, text string) []byte {
+		return append(src[:start:start], append([]byte(text), src[end:]...)...)
+	}
+
+	var importDecl *ast.GenDecl // 第一个import声明
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			continue
+		}
+		if nil == importDecl {
+			importDecl = genDecl
+		}
+		for _, spec := range genDecl.Specs {
+			importSpec := spec.(*ast.ImportSpec)
+			if importSpec.Path.Value != strconv.Quote(pkg) {
+				continue
+			}
+			if used || importSpec.Name != nil {
+				return src // 已导入, 或使用别名导入(由手写代码维护)
+			}
+			if len(genDecl.Specs) == 1 {
+				return splice(offset(genDecl.Pos()), offset(genDecl.End()), "")
+			}
+			return splice(offset(importSpec.Pos()), offset(importSpec.End()), "")
+		}
+	}
+	if !used {
+		return src
+	}
+
+	quoted := strconv.Quote(pkg)
+	switch {
+	case nil == importDecl:
+		end := offset(file.Name.End())
+		return splice(end, end, "\n\nimport "+quoted)
+	case importDecl.Lparen.IsValid():
+		end := offset(importDecl.Lparen) + 1
+		return splice(end, end, "\n"+quoted)
+	}
+	// 单行import改为import块
+	spec := string(src[offset(importDecl.Specs[0].Pos()):offset(importDecl.End())])
+	return splice(offset(importDecl.Pos()), offset(importDecl.End()), "import (\n"+spec+"\n"+quoted+"\n)")
+}
+
+// 未解析的标识符pkg作为选择器的左侧出现(注释,字符串和同名局部变量不算)
+func usesPackage(file *ast.File, pkg string) bool {
+	unresolved := make(map[*ast.Ident]bool)
+	for _, ident := range file.Unresolved {
+		if ident.Name == pkg {
+			unresolved[ident] = true
+		}
+	}
+	if len(unresolved) == 0 {
+		return false
+	}
+
+	used := false
+	ast.Inspect(file, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok && unresolved[ident] {
+				used = true
+			}
+		}
+		return !used
+	})
+	return used
+}
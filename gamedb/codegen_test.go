@@ -0,0 +1,159 @@
+package gamedb
+
+import (
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestEnsureImport(t *testing.T) {
+	const uses = "\ntype Row struct {\n\tOpen time.Time\n}\n"
+	tests := []struct {
+		name string
+		src  string
+		want string // 格式化后的结果, 为空时不变
+	}{
+		{"field type", "package p\n" + uses, "package p\n\nimport \"time\"\n" + uses},
+		{"function call", "package p\n\nfunc f() { _ = time.Now() }\n", "package p\n\nimport \"time\"\n\nfunc f() { _ = time.Now() }\n"},
+		{"comment", "package p\n\n// 使用 time.Time 前需要导入\ntype Row struct{}\n", ""},
+		{"string", "package p\n\nvar layout = \"time.Kitchen\"\n", ""},
+		{"local variable", "package p\n\nfunc f() {\n\tvar time struct{ Now int }\n\t_ = time.Now\n}\n", ""},
+		{"package variable", "package p\n\nvar time struct{ Now int }\n\nvar now = time.Now\n", ""},
+		{"imported", "package p\n\nimport \"time\"\n\nvar now = time.Now\n", ""},
+		{"import block", "package p\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n" + uses,
+			"package p\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n\t\"time\"\n)\n" + uses},
+		{"single import", "package p\n\nimport \"fmt\"\n" + uses,
+			"package p\n\nimport (\n\t\"fmt\"\n\t\"time\"\n)\n" + uses},
+		{"unused import", "package p\n\nimport \"time\"\n\ntype Row struct{}\n", "package p\n\ntype Row struct{}\n"},
+		{"unused in block", "package p\n\nimport (\n\t\"fmt\"\n\t\"time\"\n)\n\nvar s = fmt.Sprint()\n",
+			"package p\n\nimport (\n\t\"fmt\"\n)\n\nvar s = fmt.Sprint()\n"},
+		{"named import", "package p\n\nimport t \"time\"\n\ntype Row struct{}\n", ""},
+	}
+	for _, test := range tests {
+		out := ensureImport([]byte(test.src), "time")
+		if len(test.want) == 0 {
+			if string(out) != test.src {
+				t.Errorf("%s : source changed\n%s", test.name, out)
+			}
+			continue
+		}
+		formatted, err := format.Source(out)
+		if err != nil {
+			t.Errorf("%s : %v\n%s", test.name, err, out)
+			continue
+		}
+		if string(formatted) != test.want {
+			t.Errorf("%s :\n%s\nwant\n%s", test.name, formatted, test.want)
+		}
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+// 复制src目录中的源码到临时目录
+func copyGenSources(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	paths, err := filepath.Glob(filepath.Join(src, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.Base(path)), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// 源码目录与golden目录逐个文件比较, -update时改写golden
+func checkGolden(t *testing.T, dir string, golden string) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goldenPath := filepath.Join(golden, filepath.Base(path))
+		if *updateGolden {
+			if err := ioutil.WriteFile(goldenPath, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(goldenPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s :\n%s\nwant (%s)\n%s", filepath.Base(path), got, goldenPath, want)
+		}
+	}
+}
+
+func generated(t *testing.T, dir string, files []string) []string {
+	t.Helper()
+	var names []string
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 首次生成新增sheet, 再次生成不修改文件, 改名和删除列后重新生成field并保留手写代码
+func TestGenerateCodeGolden(t *testing.T) {
+	const testdata = "testdata/codegen"
+	dir := copyGenSources(t, filepath.Join(testdata, "src"))
+
+	opts := GenOptions{
+		ExcelDir:  filepath.Join(testdata, "excel1"),
+		SourceDir: dir,
+		Add:       []GenSheet{{ExcelName: "shop.csv", SheetName: "shop", Field: "Shops", Key: "Id"}},
+	}
+	files, err := GenerateCode(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(generated(t, dir, files)); got != "[excels.go gamedb.go hero.go objs.go]" {
+		t.Errorf("first run wrote %s", got)
+	}
+	checkGolden(t, dir, filepath.Join(testdata, "first"))
+
+	opts.Add = nil
+	if files, err := GenerateCode(opts); err != nil || len(files) > 0 {
+		t.Fatalf("second run wrote %v, err %v", files, err)
+	}
+	checkGolden(t, dir, filepath.Join(testdata, "first"))
+
+	opts.ExcelDir = filepath.Join(testdata, "excel2")
+	files, err = GenerateCode(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(generated(t, dir, files)); got != "[hero.go]" {
+		t.Errorf("run after column changes wrote %s", got)
+	}
+	checkGolden(t, dir, filepath.Join(testdata, "second"))
+
+	opts.Add = []GenSheet{{ExcelName: "shop.csv", SheetName: "shop", Field: "Shops"}}
+	if _, err := GenerateCode(opts); nil == err {
+		t.Fatal("adding a registered sheet should fail")
+	}
+}
@@ -0,0 +1,37 @@
+package gamedb
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// 每次Read前检查ctx,取消后返回ctx.Err().
+// 阻塞在系统调用中的Read无法打断,取消在下一次Read时生效.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (reader contextReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return reader.r.Read(p)
+}
+
+// 同ioutil.ReadFile,可取消
+func readFileContext(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(contextReader{ctx, f})
+}
@@ -1,9 +1,8 @@
 package gamedb
 
 import (
-	"fmt"
-	"strconv"
-	"strings"
+	"reflect"
+	"time"
 )
 
 const (
@@ -32,99 +31,34 @@ type PropInfo struct {
 type IntSlice []int
 type ItemInfos []*ItemInfo
 
-func (itemInfos *ItemInfos) Decode(cellString string) error {
-	if nil == itemInfos {
-		*itemInfos = make(ItemInfos, 0)
-	}
-
-	if len(cellString) == 0 {
-		return nil // 不返回错误,表格单元格数据允许为空.
-	}
-
-	list := strings.Split(strings.Trim(strings.TrimSpace(cellString), SEMICOLON), SEMICOLON)
-	if len(list) == 0 {
-		return nil
-	}
-
-	for _, elem := range list {
-		var itemInfo ItemInfo
-
-		infos := strings.Split(strings.TrimSpace(elem), COMMA)
-		if len(infos) != 2 {
-			return fmt.Errorf("ItemInfo格式错误")
-		}
-
-		id, err := strconv.Atoi(infos[0])
-		if err != nil {
-			return err
-		}
-		itemInfo.Id = id
-
-		count, err := strconv.Atoi(infos[1])
-		if err != nil {
-			return err
-		}
-		itemInfo.Count = count
+// 加载时按LoaderOptions.Location解析的Decoder, 优先于Decode(Decode使用time.Local)
+type locationDecoder interface {
+	decodeIn(cellString string, loc *time.Location) error
+}
 
-		*itemInfos = append(*itemInfos, &itemInfo)
-	}
+// 格式 : id,count;id,count
+func (itemInfos *ItemInfos) Decode(cellString string) error {
+	return itemInfos.decodeIn(cellString, time.Local)
+}
 
-	return nil
+func (itemInfos *ItemInfos) decodeIn(cellString string, loc *time.Location) error {
+	return decodeKind(reflect.ValueOf(itemInfos).Elem(), cellString, SEMICOLON+COMMA, loc)
 }
 
+// 格式 : 1,2,3 (空元素跳过)
 func (intSlice *IntSlice) Decode(cellString string) error {
-	if nil == intSlice {
-		*intSlice = make(IntSlice, 0)
-	}
-
-	if len(cellString) == 0 {
-		return nil // 不返回错误,表格单元格数据允许为空.
-	}
-
-	list := strings.Split(strings.TrimSpace(cellString), COMMA)
-	*intSlice = make(IntSlice, len(list))
-
-	for _, elem := range list {
-		if len(elem) == 0 {
-			continue
-		}
-
-		value, err := strconv.Atoi(elem)
-		if err != nil {
-			return err
-		}
-
-		*intSlice = append(*intSlice, value)
-	}
+	return intSlice.decodeIn(cellString, time.Local)
+}
 
-	return nil
+func (intSlice *IntSlice) decodeIn(cellString string, loc *time.Location) error {
+	return decodeKind(reflect.ValueOf(intSlice).Elem(), cellString, COMMA, loc)
 }
 
+// 格式 : key,value
 func (propInfo *PropInfo) Decode(cellString string) error {
-	if nil == propInfo {
-		*propInfo = PropInfo{}
-	}
-
-	if len(cellString) == 0 {
-		return nil // 不返回错误,表格单元格数据允许为空.
-	}
-
-	list := strings.Split(strings.TrimSpace(cellString), COMMA)
-	if len(list) != 2 {
-		return fmt.Errorf("属性信息格式错误:" + cellString)
-	}
-
-	key, err := strconv.Atoi(list[0])
-	if err != nil {
-		return err
-	}
-
-	value, err := strconv.Atoi(list[1])
-	if err != nil {
-		return err
-	}
+	return propInfo.decodeIn(cellString, time.Local)
+}
 
-	propInfo.Key = key
-	propInfo.Value = value
-	return nil
+func (propInfo *PropInfo) decodeIn(cellString string, loc *time.Location) error {
+	return decodeKind(reflect.ValueOf(propInfo).Elem(), cellString, COMMA, loc)
 }
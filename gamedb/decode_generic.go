@@ -0,0 +1,265 @@
+package gamedb
+
+import (
+	"fmt"
+	"parser/util"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 通用单元格解析: 由sep tag指定每一层的分隔符(从外到内,每个字符一层), 一个单元格解析为复合类型.
+//   []T         sep:","   1,2,3
+//   [][]T       sep:";,"  1,2;3,4
+//   [N]T        sep:","   1,2 (不足N个时其余为零值)
+//   map[K]V     sep:";:"  1:10;2:20 (一层分隔键值对,一层分隔键和值)
+//   struct      sep:","   按导出field顺序填写, e.g : PropInfo 1,100
+//   []*struct   sep:";,"  e.g : ItemInfos 1001,1;1002,5
+// 元素实现了Decoder时交给Decoder解析剩余文本. 支持基础类型, time.Time和time.Duration.
+
+// 解析cellString到v, seps为剩余的分隔符
+func decodeValue(v reflect.Value, cellString string, seps string, loc *time.Location) error {
+	cellString = strings.TrimSpace(cellString)
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(v.Elem(), cellString, seps, loc)
+	}
+
+	if v.CanAddr() {
+		if decoder, ok := v.Addr().Interface().(locationDecoder); ok {
+			return decoder.decodeIn(cellString, loc)
+		}
+		if decoder, ok := v.Addr().Interface().(Decoder); ok {
+			return decoder.Decode(cellString)
+		}
+	}
+	return decodeKind(v, cellString, seps, loc)
+}
+
+// 不检查Decoder,按类型解析(供复合类型的Decode方法使用)
+func decodeKind(v reflect.Value, cellString string, seps string, loc *time.Location) error {
+	cellString = strings.TrimSpace(cellString)
+
+	switch v.Type() {
+	case timeType:
+		if len(cellString) == 0 {
+			return nil
+		}
+		cellTime, err := parseCellTime(cellString, loc)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(cellTime))
+		return nil
+	case durationType:
+		if len(cellString) == 0 {
+			return nil
+		}
+		cellDuration, err := parseCellDuration(cellString)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(cellDuration))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		return decodeSlice(v, cellString, seps, loc)
+	case reflect.Array:
+		return decodeArray(v, cellString, seps, loc)
+	case reflect.Map:
+		return decodeMap(v, cellString, seps, loc)
+	case reflect.Struct:
+		return decodeStruct(v, cellString, seps, loc)
+	}
+
+	// 基础类型无数据不解析,使用默认零值
+	if len(cellString) == 0 {
+		return nil
+	}
+	return decodeBasic(v, cellString)
+}
+
+// 返回第一层分隔符和剩余的分隔符
+func nextSep(seps string, t reflect.Type) (string, string, error) {
+	if len(seps) == 0 {
+		return "", "", fmt.Errorf("no separator left for %s, add one to sep tag", t)
+	}
+	_, size := utf8.DecodeRuneInString(seps)
+	return seps[:size], seps[size:], nil
+}
+
+// 按sep拆分, 忽略首尾多余的分隔符
+func splitCell(cellString string, sep string) []string {
+	cellString = strings.Trim(cellString, sep)
+	if len(cellString) == 0 {
+		return nil
+	}
+	return strings.Split(cellString, sep)
+}
+
+// 空元素跳过. 无数据时分配空slice.
+func decodeSlice(v reflect.Value, cellString string, seps string, loc *time.Location) error {
+	sep, rest, err := nextSep(seps, v.Type())
+	if err != nil {
+		return err
+	}
+
+	list := splitCell(cellString, sep)
+	slice := reflect.MakeSlice(v.Type(), 0, len(list))
+	for _, elem := range list {
+		if len(strings.TrimSpace(elem)) == 0 {
+			continue
+		}
+		elemV := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeValue(elemV, elem, rest, loc); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elemV)
+	}
+	v.Set(slice)
+	return nil
+}
+
+// 按位置解析,空元素为零值(开头的分隔符不能去除), 忽略末尾多余的分隔符
+func decodeArray(v reflect.Value, cellString string, seps string, loc *time.Location) error {
+	sep, rest, err := nextSep(seps, v.Type())
+	if err != nil {
+		return err
+	}
+
+	var list []string
+	if cellString = strings.TrimRight(cellString, sep); len(cellString) > 0 {
+		list = strings.Split(cellString, sep)
+	}
+	if len(list) > v.Len() {
+		return fmt.Errorf("%q has %d elements, %s allows %d", cellString, len(list), v.Type(), v.Len())
+	}
+	for i := 0; i < v.Len(); i++ {
+		elem := ""
+		if i < len(list) {
+			elem = list[i]
+		}
+		if err := decodeValue(v.Index(i), elem, rest, loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeMap(v reflect.Value, cellString string, seps string, loc *time.Location) error {
+	sep, rest, err := nextSep(seps, v.Type())
+	if err != nil {
+		return err
+	}
+	kvSep, rest, err := nextSep(rest, v.Type())
+	if err != nil {
+		return err
+	}
+
+	list := splitCell(cellString, sep)
+	m := reflect.MakeMapWithSize(v.Type(), len(list))
+	for _, elem := range list {
+		if len(strings.TrimSpace(elem)) == 0 {
+			continue
+		}
+		kv := strings.SplitN(elem, kvSep, 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("%q should be key%svalue", elem, kvSep)
+		}
+
+		keyV := reflect.New(v.Type().Key()).Elem()
+		if err := decodeValue(keyV, kv[0], "", loc); err != nil {
+			return err
+		}
+		if m.MapIndex(keyV).IsValid() {
+			return fmt.Errorf("duplicate key %q", strings.TrimSpace(kv[0]))
+		}
+		valueV := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeValue(valueV, kv[1], rest, loc); err != nil {
+			return err
+		}
+		m.SetMapIndex(keyV, valueV)
+	}
+	v.Set(m)
+	return nil
+}
+
+// 按导出field的顺序解析, 无数据时为零值, 否则数量必须一致(允许末尾多一个分隔符)
+func decodeStruct(v reflect.Value, cellString string, seps string, loc *time.Location) error {
+	if len(cellString) == 0 {
+		return nil
+	}
+
+	sep, rest, err := nextSep(seps, v.Type())
+	if err != nil {
+		return err
+	}
+
+	var fields []int
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).CanSet() {
+			fields = append(fields, i)
+		}
+	}
+
+	list := strings.Split(cellString, sep)
+	if len(list) == len(fields)+1 && len(strings.TrimSpace(list[len(fields)])) == 0 {
+		list = list[:len(fields)]
+	}
+	if len(list) != len(fields) {
+		return fmt.Errorf("%q has %d elements, %s needs %d", cellString, len(list), v.Type(), len(fields))
+	}
+	for i, idx := range fields {
+		if err := decodeValue(v.Field(idx), list[i], rest, loc); err != nil {
+			return fmt.Errorf("%s.%s : %w", v.Type().Name(), v.Type().Field(idx).Name, err)
+		}
+	}
+	return nil
+}
+
+// 基础类型解析
+func decodeBasic(v reflect.Value, cellString string) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		cellBool, err := strconv.ParseBool(cellString)
+		if err != nil {
+			return fmt.Errorf("ParseBool err : %s", err.Error())
+		}
+		v.SetBool(cellBool)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// 整数直接解析(超过2^53的整数转换为浮点数会丢失精度), 否则按浮点数四舍五入(e.g : 1.0)
+		if cellInt, err := strconv.ParseInt(cellString, 10, 64); nil == err {
+			v.SetInt(cellInt)
+			break
+		}
+		cellFloat, err := strconv.ParseFloat(cellString, 64)
+		if err != nil {
+			return fmt.Errorf("ParseFloat for Int err : %s", err.Error())
+		}
+		v.SetInt(int64(util.RoundFloat(cellFloat, 0)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		cellUint, err := strconv.ParseUint(cellString, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ParseUint err : %s", err.Error())
+		}
+		v.SetUint(cellUint)
+	case reflect.Float32, reflect.Float64:
+		cellFloat, err := strconv.ParseFloat(cellString, 64)
+		if err != nil {
+			return fmt.Errorf("ParseFloat err : %s", err.Error())
+		}
+		v.SetFloat(cellFloat)
+	case reflect.String:
+		v.SetString(cellString)
+	default:
+		return fmt.Errorf("field type error")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package gamedb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 包含时间的复合类型: 加载时按Location解析
+type testOpening struct {
+	Start time.Time
+	Days  int
+}
+
+func (opening *testOpening) Decode(cellString string) error {
+	return opening.decodeIn(cellString, time.Local)
+}
+
+func (opening *testOpening) decodeIn(cellString string, loc *time.Location) error {
+	return decodeKind(reflect.ValueOf(opening).Elem(), cellString, COMMA, loc)
+}
+
+type testOpeningRow struct {
+	Id       int           `col:"id"`
+	Opening  testOpening   `col:"opening"`
+	Openings []testOpening `col:"openings" sep:";"`
+}
+
+func TestDecoderUsesLoaderLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	objs, err := readTestSheetIn(&testOpeningRow{}, [][]string{
+		nil,
+		nil,
+		{"", "id", "opening", "openings"},
+		{"", "1", "2024-05-01 10:00:00,7", "2024-06-01 00:00:00,1;2024-07-01 00:00:00,2"},
+	}, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := objs[0].(*testOpeningRow)
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, loc)
+	if !row.Opening.Start.Equal(want) || row.Opening.Days != 7 {
+		t.Fatalf("opening = %+v, want %s,7", row.Opening, want)
+	}
+	if len(row.Openings) != 2 || !row.Openings[1].Start.Equal(time.Date(2024, 7, 1, 0, 0, 0, 0, loc)) {
+		t.Fatalf("openings = %+v", row.Openings)
+	}
+}
+
+func TestCompositeDecoders(t *testing.T) {
+	var itemInfos ItemInfos
+	if err := itemInfos.Decode("1001,1;1002,5;"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (ItemInfos{{1001, 1}, {1002, 5}}); !reflect.DeepEqual(itemInfos, want) {
+		t.Fatalf("ItemInfos = %v, want %v", itemInfos, want)
+	}
+
+	var propInfo PropInfo
+	if err := propInfo.Decode("3,100"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (PropInfo{3, 100}); propInfo != want {
+		t.Fatalf("PropInfo = %v, want %v", propInfo, want)
+	}
+	if err := propInfo.Decode("3"); nil == err {
+		t.Fatal("PropInfo should reject a single value")
+	}
+}
+
+// 旧的IntSlice.Decode在结果前面多出len(list)个0(e.g : "1,2" -> [0 0 1 2])
+func TestIntSliceDecode(t *testing.T) {
+	tests := []struct {
+		cell string
+		want IntSlice
+	}{
+		{"", IntSlice{}},
+		{"7", IntSlice{7}},
+		{"1,2,3", IntSlice{1, 2, 3}},
+		{" 1, 2 ", IntSlice{1, 2}},
+		{",1,,2,", IntSlice{1, 2}},
+		{"0,5", IntSlice{0, 5}},
+	}
+	for _, test := range tests {
+		var intSlice IntSlice
+		if err := intSlice.Decode(test.cell); err != nil {
+			t.Fatalf("Decode(%q) : %v", test.cell, err)
+		}
+		if !reflect.DeepEqual(intSlice, test.want) {
+			t.Errorf("Decode(%q) = %v, want %v", test.cell, intSlice, test.want)
+		}
+	}
+
+	var intSlice IntSlice
+	if err := intSlice.Decode("1,a"); nil == err {
+		t.Fatal("Decode(1,a) should fail")
+	}
+}
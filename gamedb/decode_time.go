@@ -0,0 +1,169 @@
+package gamedb
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 表格中的日期,时间和时长.
+// xlsx日期单元格按单元格格式输出文本(e.g : 2024/1/2 10:30), 常规格式输出日期序列号(e.g : 45293.4375),
+// 两种写法都支持. 不带时区的时间按LoaderOptions.Location(服务器时区)解析.
+
+const secondsPerDay = 24 * 60 * 60
+
+// Excel日期序列号上限(9999-12-31)
+const maxExcelSerial = 2958466
+
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// 支持的日期文本格式, 月日时为单个数字的格式同样可以解析两位数字
+var cellTimeLayouts = []string{
+	"2006-1-2 15:04:05",
+	"2006-1-2 15:04",
+	"2006-1-2T15:04:05",
+	"2006-1-2",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+	"2006/1/2",
+	"01-02-06",     // xlsx内置格式14(mm-dd-yy)
+	"1/2/06 15:04", // xlsx内置格式22(m/d/yy h:mm)
+}
+
+// 解析日期: Excel日期序列号, 带时区的RFC3339, 或cellTimeLayouts中不带时区的格式(按loc解析)
+func parseCellTime(cellString string, loc *time.Location) (time.Time, error) {
+	if serial, err := strconv.ParseFloat(cellString, 64); nil == err {
+		if serial < 0 || serial >= maxExcelSerial {
+			return time.Time{}, fmt.Errorf("date serial %s out of range", cellString)
+		}
+		days := math.Floor(serial)
+		seconds := int(math.Round((serial - days) * secondsPerDay))
+		return time.Date(1899, 12, 30+int(days), 0, 0, seconds, 0, loc), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, cellString); nil == err {
+		return t.In(loc), nil
+	}
+
+	for _, layout := range cellTimeLayouts {
+		if t, err := time.ParseInLocation(layout, cellString, loc); nil == err {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, use yyyy-mm-dd hh:mm:ss", cellString)
+}
+
+// 解析时长: Go时长格式(e.g : 1h30m), 秒数(e.g : 90, 1.5), 或时钟格式(e.g : 1:30:00, 可超过24小时)
+func parseCellDuration(cellString string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(cellString, 64); nil == err {
+		return time.Duration(math.Round(seconds * float64(time.Second))), nil
+	}
+
+	if strings.Contains(cellString, COLON) {
+		seconds, err := parseClock(cellString, math.MaxInt32)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	duration, err := time.ParseDuration(cellString)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, use 1h30m or seconds", cellString)
+	}
+	return duration, nil
+}
+
+// 解析H:MM或H:MM:SS, 返回秒数. 小时不能超过maxHour
+func parseClock(cellString string, maxHour int) (int, error) {
+	list := strings.Split(cellString, COLON)
+	if len(list) < 2 || len(list) > 3 {
+		return 0, fmt.Errorf("invalid time %q, use hh:mm or hh:mm:ss", cellString)
+	}
+
+	var values [3]int
+	for i, elem := range list {
+		value, err := strconv.Atoi(strings.TrimSpace(elem))
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid time %q, use hh:mm or hh:mm:ss", cellString)
+		}
+		values[i] = value
+	}
+
+	if values[0] > maxHour || values[1] >= 60 || values[2] >= 60 {
+		return 0, fmt.Errorf("time %q out of range", cellString)
+	}
+	return values[0]*3600 + values[1]*60 + values[2], nil
+}
+
+// 一天中的时间(e.g : 每日重置时间), 从0点开始的秒数
+type TimeOfDay int
+
+func NewTimeOfDay(hour, minute, second int) TimeOfDay {
+	return TimeOfDay(hour*3600 + minute*60 + second)
+}
+
+// 支持hh:mm, hh:mm:ss, 以及xlsx常规格式输出的一天的比例(e.g : 0.5为12:00)
+func (timeOfDay *TimeOfDay) Decode(cellString string) error {
+	*timeOfDay = 0
+
+	if len(cellString) == 0 {
+		return nil // 不返回错误,表格单元格数据允许为空.
+	}
+
+	if fraction, err := strconv.ParseFloat(cellString, 64); nil == err {
+		seconds := int(math.Round(fraction * secondsPerDay))
+		if fraction < 0 || seconds >= secondsPerDay {
+			return fmt.Errorf("time of day %s out of range", cellString)
+		}
+		*timeOfDay = TimeOfDay(seconds)
+		return nil
+	}
+
+	seconds, err := parseClock(cellString, 23)
+	if err != nil {
+		return err
+	}
+	*timeOfDay = TimeOfDay(seconds)
+	return nil
+}
+
+func (timeOfDay TimeOfDay) Hour() int {
+	return int(timeOfDay) / 3600
+}
+
+func (timeOfDay TimeOfDay) Minute() int {
+	return int(timeOfDay) % 3600 / 60
+}
+
+func (timeOfDay TimeOfDay) Second() int {
+	return int(timeOfDay) % 60
+}
+
+// 距0点的时长
+func (timeOfDay TimeOfDay) Duration() time.Duration {
+	return time.Duration(timeOfDay) * time.Second
+}
+
+// day当天(day的时区)的该时间
+func (timeOfDay TimeOfDay) On(day time.Time) time.Time {
+	year, month, date := day.Date()
+	return time.Date(year, month, date, timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second(), 0, day.Location())
+}
+
+// now之后(不含now)最近的该时间, e.g : 下一次每日重置
+func (timeOfDay TimeOfDay) Next(now time.Time) time.Time {
+	next := timeOfDay.On(now)
+	if !next.After(now) {
+		next = timeOfDay.On(now.AddDate(0, 0, 1))
+	}
+	return next
+}
+
+func (timeOfDay TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d", timeOfDay.Hour(), timeOfDay.Minute(), timeOfDay.Second())
+}
@@ -0,0 +1,310 @@
+package gamedb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decoder的逆操作: 将解析后的值转换回单元格文本(写回表格,生成文本镜像,显示规范化的单元格值).
+// 对Encode的结果Decode应得到相同的值; 无法还原的值(e.g : 元素中含有分隔符,slice中的空元素,首尾空白)返回错误.
+type Encoder interface {
+	Encode() (string, error)
+}
+
+// 按LoaderOptions.Location输出的Encoder, 优先于Encode(Encode使用time.Local)
+type locationEncoder interface {
+	encodeIn(loc *time.Location) (string, error)
+}
+
+// 日期统一输出的格式(cellTimeLayouts的第一个)
+const cellTimeLayout = "2006-01-02 15:04:05"
+
+func (itemInfos ItemInfos) Encode() (string, error) {
+	return itemInfos.encodeIn(time.Local)
+}
+
+func (itemInfos ItemInfos) encodeIn(loc *time.Location) (string, error) {
+	return encodeKind(reflect.ValueOf(itemInfos), SEMICOLON+COMMA, loc)
+}
+
+func (intSlice IntSlice) Encode() (string, error) {
+	return intSlice.encodeIn(time.Local)
+}
+
+func (intSlice IntSlice) encodeIn(loc *time.Location) (string, error) {
+	return encodeKind(reflect.ValueOf(intSlice), COMMA, loc)
+}
+
+func (propInfo PropInfo) Encode() (string, error) {
+	return propInfo.encodeIn(time.Local)
+}
+
+func (propInfo PropInfo) encodeIn(loc *time.Location) (string, error) {
+	return encodeKind(reflect.ValueOf(propInfo), COMMA, loc)
+}
+
+func (timeOfDay TimeOfDay) Encode() (string, error) {
+	if timeOfDay < 0 || timeOfDay >= secondsPerDay {
+		return "", fmt.Errorf("time of day %d out of range", int(timeOfDay))
+	}
+	return timeOfDay.String(), nil
+}
+
+// 按obj的col tag和group tag将一行数据转换为单元格文本, 返回列名和对应的单元格.
+// 多列字段按元素输出列(e.g : reward1, reward2 或 rewardId1, rewardCount1), 元素为结构体且没有sep tag和Decoder时每个field一列.
+func EncodeRow(obj interface{}, loc *time.Location) ([]string, []string, error) {
+	objV := reflect.ValueOf(obj)
+	if objV.Kind() == reflect.Ptr {
+		objV = objV.Elem()
+	}
+	if objV.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("obj must be a struct")
+	}
+
+	var cols, cells []string
+	for i := 0; i < objV.NumField(); i++ {
+		field := objV.Type().Field(i)
+		col := field.Tag.Get("col")
+		if group := field.Tag.Get("group"); len(group) > 0 && len(col) == 0 {
+			groupCols, groupCells, err := encodeGroup(objV, i, loc)
+			if err != nil {
+				return nil, nil, fmt.Errorf("group %s : %w", group, err)
+			}
+			cols = append(cols, groupCols...)
+			cells = append(cells, groupCells...)
+			continue
+		}
+		if len(col) == 0 {
+			continue
+		}
+		cell, err := encodeField(objV.Field(i), field, loc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("column %s : %w", col, err)
+		}
+		cols = append(cols, col)
+		cells = append(cells, cell)
+	}
+	return cols, cells, nil
+}
+
+// 列对应的单元格文本(decodeRow中单元格解析的逆操作), objV为结构体
+func encodeColumn(objV reflect.Value, info *fieldInfo, loc *time.Location) (string, error) {
+	if len(info.group) == 0 {
+		return encodeField(objV.Field(info.idx), *info.field, loc)
+	}
+
+	v, ok := columnValue(objV, info)
+	if !ok {
+		return "", nil
+	}
+
+	seps := info.field.Tag.Get("sep")
+	if info.sub >= 0 {
+		elemT := info.field.Type
+		if info.elem >= 0 {
+			elemT = elemT.Elem()
+		}
+		if elemT.Kind() == reflect.Ptr {
+			elemT = elemT.Elem()
+		}
+		if sub := elemT.Field(info.sub).Tag.Get("sep"); len(sub) > 0 {
+			seps = sub
+		}
+	}
+
+	return encodeValue(v, seps, loc)
+}
+
+// decodeRow中单元格解析的逆操作
+func encodeField(fieldV reflect.Value, field reflect.StructField, loc *time.Location) (string, error) {
+	if encoder, ok := fieldV.Interface().(locationEncoder); ok {
+		return encoder.encodeIn(loc)
+	}
+	if encoder, ok := fieldV.Interface().(Encoder); ok {
+		return encoder.Encode()
+	}
+
+	if seps := field.Tag.Get("sep"); len(seps) > 0 {
+		return encodeValue(fieldV, seps, loc)
+	}
+
+	// 解析时去除了换行并转义了引号
+	if fieldV.Kind() == reflect.String {
+		str := fieldV.String()
+		cell := strings.Replace(str, `\"`, `"`, -1)
+		if strings.Contains(str, "\n") || strings.Replace(cell, `"`, `\"`, -1) != str {
+			return "", fmt.Errorf("%q has a line break or an unescaped quote", str)
+		}
+		if strings.TrimSpace(cell) != cell {
+			return "", fmt.Errorf("%q has leading or trailing spaces", str)
+		}
+		return cell, nil
+	}
+	return encodeValue(fieldV, "", loc)
+}
+
+// decodeValue的逆操作, seps为剩余的分隔符
+func encodeValue(v reflect.Value, seps string, loc *time.Location) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		return encodeValue(v.Elem(), seps, loc)
+	}
+
+	if v.CanInterface() {
+		if encoder, ok := v.Interface().(locationEncoder); ok {
+			return encoder.encodeIn(loc)
+		}
+		if encoder, ok := v.Interface().(Encoder); ok {
+			return encoder.Encode()
+		}
+	}
+	return encodeKind(v, seps, loc)
+}
+
+// 不检查Encoder,按类型转换(供复合类型的Encode方法使用)
+func encodeKind(v reflect.Value, seps string, loc *time.Location) (string, error) {
+	switch v.Type() {
+	case timeType:
+		cellTime := v.Interface().(time.Time)
+		if cellTime.IsZero() {
+			return "", nil
+		}
+		if cellTime.Nanosecond() != 0 {
+			return "", fmt.Errorf("time %s has sub-second precision", cellTime)
+		}
+		if year := cellTime.In(loc).Year(); year < 1 || year > 9999 {
+			return "", fmt.Errorf("time %s out of range", cellTime)
+		}
+		return cellTime.In(loc).Format(cellTimeLayout), nil
+	case durationType:
+		return time.Duration(v.Int()).String(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		sep, rest, err := nextSep(seps, v.Type())
+		if err != nil {
+			return "", err
+		}
+		list := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, err := encodeValue(v.Index(i), rest, loc)
+			if err != nil {
+				return "", err
+			}
+			// slice解析时跳过空元素, array按位置解析
+			if len(elem) == 0 && v.Kind() == reflect.Slice {
+				return "", fmt.Errorf("element %d of %s is empty", i, v.Type())
+			}
+			if err := checkElem(elem, sep); err != nil {
+				return "", err
+			}
+			list = append(list, elem)
+		}
+		return strings.Join(list, sep), nil
+	case reflect.Map:
+		return encodeMap(v, seps, loc)
+	case reflect.Struct:
+		sep, rest, err := nextSep(seps, v.Type())
+		if err != nil {
+			return "", err
+		}
+		var list []string
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			elem, err := encodeValue(v.Field(i), rest, loc)
+			if err != nil {
+				return "", err
+			}
+			if err := checkElem(elem, sep); err != nil {
+				return "", err
+			}
+			list = append(list, elem)
+		}
+		return strings.Join(list, sep), nil
+	}
+	return encodeBasic(v)
+}
+
+// 元素中不能出现本层的分隔符(解析时会被拆开)
+func checkElem(elem string, sep string) error {
+	if strings.Contains(elem, sep) {
+		return fmt.Errorf("%q contains separator %q", elem, sep)
+	}
+	return nil
+}
+
+// 按key排序输出,同一个map的结果固定
+func encodeMap(v reflect.Value, seps string, loc *time.Location) (string, error) {
+	sep, rest, err := nextSep(seps, v.Type())
+	if err != nil {
+		return "", err
+	}
+	kvSep, rest, err := nextSep(rest, v.Type())
+	if err != nil {
+		return "", err
+	}
+
+	type entry struct {
+		key   string
+		value string
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := encodeValue(iter.Key(), "", loc)
+		if err != nil {
+			return "", err
+		}
+		if err := checkElem(key, kvSep); err != nil {
+			return "", err
+		}
+		value, err := encodeValue(iter.Value(), rest, loc)
+		if err != nil {
+			return "", err
+		}
+		if err := checkElem(key+kvSep+value, sep); err != nil {
+			return "", err
+		}
+		entries = append(entries, entry{key, value})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return lessKey(entries[i].key, entries[j].key)
+	})
+
+	list := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry.key+kvSep+entry.value)
+	}
+	return strings.Join(list, sep), nil
+}
+
+func encodeBasic(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.String:
+		// 解析时去除首尾空白
+		if strings.TrimSpace(v.String()) != v.String() {
+			return "", fmt.Errorf("%q has leading or trailing spaces", v.String())
+		}
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("field type error")
+}
@@ -0,0 +1,312 @@
+package gamedb
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+const roundTripCount = 500
+
+// 随机生成typ的值, Encode成功时Decode应得到相同的值. 至少minEncoded个值能够Encode, 避免检查为空.
+func checkRoundTrip(t *testing.T, typ reflect.Type, minEncoded int,
+	encode func(reflect.Value) (string, error), decode func(reflect.Value, string) error) {
+	t.Helper()
+	r := rand.New(rand.NewSource(1))
+	encoded := 0
+	for i := 0; i < roundTripCount; i++ {
+		x, ok := quick.Value(typ, r)
+		if !ok {
+			t.Fatalf("can not generate %s", typ)
+		}
+		cell, err := encode(x)
+		if err != nil {
+			continue
+		}
+		encoded++
+
+		y := reflect.New(typ).Elem()
+		if err := decode(y, cell); err != nil {
+			t.Fatalf("%s : Decode(%q) of %#v : %v", typ, cell, x.Interface(), err)
+		}
+		if !reflect.DeepEqual(x.Interface(), y.Interface()) {
+			t.Fatalf("%s : Decode(Encode(x)) = %#v, x = %#v, cell %q", typ, y.Interface(), x.Interface(), cell)
+		}
+	}
+	if encoded < minEncoded {
+		t.Fatalf("%s : only %d of %d values encoded", typ, encoded, roundTripCount)
+	}
+}
+
+func encodeWith(v reflect.Value) (string, error) {
+	return v.Interface().(Encoder).Encode()
+}
+
+func decodeWith(v reflect.Value, cell string) error {
+	return v.Addr().Interface().(Decoder).Decode(cell)
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	checkRoundTrip(t, reflect.TypeOf(IntSlice{}), roundTripCount, encodeWith, decodeWith)
+	checkRoundTrip(t, reflect.TypeOf(ItemInfos{}), roundTripCount/4, encodeWith, decodeWith)
+	checkRoundTrip(t, reflect.TypeOf(PropInfo{}), roundTripCount, encodeWith, decodeWith)
+}
+
+func TestTimeOfDayRoundTrip(t *testing.T) {
+	for seconds := 0; seconds < secondsPerDay; seconds += 37 {
+		timeOfDay := TimeOfDay(seconds)
+		cell, err := timeOfDay.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded TimeOfDay
+		if err := decoded.Decode(cell); err != nil || decoded != timeOfDay {
+			t.Fatalf("Decode(%q) = %d, %v; want %d", cell, decoded, err, timeOfDay)
+		}
+	}
+	if _, err := TimeOfDay(secondsPerDay).Encode(); nil == err {
+		t.Fatal("TimeOfDay out of range should not encode")
+	}
+}
+
+func TestGenericRoundTrip(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		seps  string
+	}{
+		{[]string{}, COMMA},
+		{[]int64{}, COMMA},
+		{[]float64{}, COMMA},
+		{[]bool{}, COMMA},
+		{[][]int{}, SEMICOLON + COMMA},
+		{[3]string{}, COMMA},
+		{map[int]string{}, SEMICOLON + COLON},
+		{map[string][]int{}, SEMICOLON + COLON + COMMA},
+		{[]PropInfo{}, SEMICOLON + COMMA},
+		{[]time.Duration{}, COMMA},
+		{struct {
+			A string
+			B []uint
+		}{}, PIPE + COMMA},
+	}
+	for _, test := range tests {
+		typ := reflect.TypeOf(test.value)
+		checkRoundTrip(t, typ, roundTripCount/10,
+			func(v reflect.Value) (string, error) {
+				return encodeValue(v, test.seps, time.UTC)
+			},
+			func(v reflect.Value, cell string) error {
+				return decodeValue(v, cell, test.seps, time.UTC)
+			})
+	}
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < roundTripCount; i++ {
+		value := time.Unix(r.Int63n(4e9), 0)
+		cell, err := encodeValue(reflect.ValueOf(value), "", loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := reflect.New(timeType).Elem()
+		if err := decodeValue(decoded, cell, "", loc); err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.Interface().(time.Time).Equal(value) {
+			t.Fatalf("Decode(%q) = %s, want %s", cell, decoded.Interface(), value)
+		}
+	}
+
+	if _, err := encodeValue(reflect.ValueOf(time.Unix(0, 1)), "", loc); nil == err {
+		t.Fatal("sub-second time should not encode")
+	}
+}
+
+// 无法还原的值返回错误
+func TestEncodeRejectsLossyValues(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		seps  string
+	}{
+		{[]string{"x", "y,z"}, COMMA},
+		{[]string{"x", ""}, COMMA},
+		{[]string{" x"}, COMMA},
+		{[][]int{{1}, {}}, SEMICOLON + COMMA},
+		{map[string]int{"a:b": 1}, SEMICOLON + COLON},
+		{map[int]string{1: "a;b"}, SEMICOLON + COLON},
+		{ItemInfos{nil}, SEMICOLON + COMMA},
+	}
+	for _, test := range tests {
+		if cell, err := encodeValue(reflect.ValueOf(test.value), test.seps, time.UTC); nil == err {
+			t.Errorf("%#v encoded to %q, want error", test.value, cell)
+		}
+	}
+}
+
+type testRoundTripReward struct {
+	Id    int
+	Count int
+}
+
+type testRoundTripRow struct {
+	Id      int                    `col:"id"`
+	Name    string                 `col:"name"`
+	Rate    float64                `col:"rate"`
+	Open    bool                   `col:"open"`
+	Items   ItemInfos              `col:"items"`
+	Tags    []string               `col:"tags" sep:","`
+	Weights map[int]int            `col:"weights" sep:";:"`
+	Levels  [3]int                 `group:"lv"`
+	Colors  []int                  `group:"color"`
+	Rewards [2]testRoundTripReward `group:"reward"`
+	Attrs   []PropInfo             `group:"attr"`
+}
+
+// 按EncodeRow输出的列组成sheet再解析
+func decodeRowCells(obj interface{}, cols []string, cells []string) (interface{}, error) {
+	objs, err := readTestSheet(obj, [][]string{
+		nil,
+		nil,
+		append([]string{""}, cols...),
+		append([]string{""}, cells...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objs[0], nil
+}
+
+func TestEncodeRowRoundTrip(t *testing.T) {
+	var objs []interface{}
+	for _, excelInfo := range DefaultRegistry().files {
+		for _, info := range excelInfo.sheetInfos {
+			objs = append(objs, info.obj)
+		}
+	}
+	objs = append(objs, &testRoundTripRow{})
+
+	for _, obj := range objs {
+		typ := reflect.TypeOf(obj).Elem()
+		var cols []string
+		checkRoundTrip(t, typ, roundTripCount/20,
+			func(v reflect.Value) (string, error) {
+				var cells []string
+				var err error
+				cols, cells, err = EncodeRow(v.Interface(), time.UTC)
+				return strings.Join(cells, "\x00"), err
+			},
+			func(v reflect.Value, cell string) error {
+				decoded, err := decodeRowCells(reflect.New(typ).Interface(), cols, strings.Split(cell, "\x00"))
+				if err != nil {
+					return err
+				}
+				v.Set(reflect.ValueOf(decoded).Elem())
+				return nil
+			})
+	}
+}
+
+func TestEncodeRowGroupColumns(t *testing.T) {
+	row := &testRoundTripRow{
+		Id:      1,
+		Levels:  [3]int{1, 0, 3},
+		Colors:  []int{4, 5},
+		Rewards: [2]testRoundTripReward{{1001, 2}},
+		Attrs:   []PropInfo{{1, 100}},
+		Items:   ItemInfos{},
+	}
+	cols, cells, err := EncodeRow(row, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"lv1": "1", "lv2": "0", "lv3": "3",
+		"color1": "4", "color2": "5",
+		"rewardId1": "1001", "rewardCount1": "2", "rewardId2": "0", "rewardCount2": "0",
+		"attr1": "1,100",
+	}
+	got := make(map[string]string)
+	for i, col := range cols {
+		got[col] = cells[i]
+	}
+	for col, cell := range want {
+		if got[col] != cell {
+			t.Errorf("column %s = %q, want %q", col, got[col], cell)
+		}
+	}
+
+	decoded, err := decodeRowCells(&testRoundTripRow{}, cols, cells)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row.Tags, row.Weights = []string{}, map[int]int{}
+	if !reflect.DeepEqual(decoded, row) {
+		t.Fatalf("decoded %+v, want %+v", decoded, row)
+	}
+
+	// 解析时slice末尾没有数据的元素会被去除
+	lossy := &struct {
+		Id    int      `col:"id"`
+		Names []string `group:"name"`
+	}{Id: 1, Names: []string{"a", ""}}
+	if _, _, err := EncodeRow(lossy, time.UTC); nil == err {
+		t.Fatal("trailing empty group element should not encode")
+	}
+}
+
+type testMirrorRow struct {
+	Id    int      `col:"id"`
+	Rate  float64  `col:"rate"`
+	Tags  []string `col:"tags" sep:","`
+	Level [2]int   `group:"lv"`
+}
+
+func TestEncodeMirrorNormalizesCells(t *testing.T) {
+	sheet := mirrorSheet{excelName: "test.xlsx", sheetName: "test", obj: &testMirrorRow{}, key: "Id"}
+	table := &sheetTable{rows: [][]string{
+		{"", "编号", "比例", "标签", "等级1", "等级2", "备注"},
+		nil,
+		{"", "id", "rate", "tags", "lv1", "lv2", "note"},
+		{"", "2.0", "0.50", "a, b,", "", "3", " 注释 "},
+		{"", "1", "1", "", "1", "", ""},
+	}}
+
+	b, err := encodeMirror(sheet, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ",编号,比例,标签,等级1,等级2,备注\n" +
+		"\n" +
+		",id,rate,tags,lv1,lv2,note\n" +
+		",1,1,,1,0\n" +
+		",2,0.5,\"a,b\",0,3,注释\n"
+	if string(b) != want {
+		t.Fatalf("mirror =\n%s\nwant\n%s", b, want)
+	}
+
+	// slice sheet的行顺序即加载顺序, 不排序
+	sheet.key = ""
+	b, err = encodeMirror(sheet, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = ",编号,比例,标签,等级1,等级2,备注\n" +
+		"\n" +
+		",id,rate,tags,lv1,lv2,note\n" +
+		",2,0.5,\"a,b\",0,3,注释\n" +
+		",1,1,,1,0\n"
+	if string(b) != want {
+		t.Fatalf("array sheet mirror =\n%s\nwant\n%s", b, want)
+	}
+
+	table.rows[3][2] = "x"
+	if _, err := encodeMirror(sheet, table); nil == err {
+		t.Fatal("encodeMirror should fail on a row that does not decode")
+	}
+}
@@ -5,33 +5,61 @@ type fileInfo struct {
 	sheetInfos []sheetInfo
 }
 
-type fileRecords map[string]int64
-
-var fileInfos []fileInfo    // 所有表格文件
-var fileModTime fileRecords // 文件修改时间记录
-
-// package func init() before main
-func init() {
-	fileInfos = []fileInfo{
-		{"item.xlsx", []sheetInfo{
-			{"item", &Item{}, mapLoader("Items", "Id")},
-		}},
-		{"otherData.xlsx", []sheetInfo{
-			{"otherData", &OtherData{}, arrayLoader("Items")},
-		}},
-	}
+type fileRecords map[string]int64 // 文件修改时间记录
+
+// 表格注册表: 需要加载的表格文件和sheet, 按注册顺序执行loader
+type Registry struct {
+	files []fileInfo
+}
+
+// 所有表格文件
+// 标记区域由sheettool gen根据注册的表格重新生成; 使用自定义loader的sheet在区域外注册.
+func DefaultRegistry() *Registry {
+	registry := &Registry{}
+	// sheettool gen registry begin
+	registry.register("item.xlsx",
+		mapSheet("item", &Item{}, "Items", "Id"),
+	)
+	registry.register("otherData.xlsx",
+		arraySheet("otherData", &OtherData{}, "OtherDatas"),
+	)
+	// sheettool gen registry end
+	return registry
+}
+
+// 按key填充到GameDB的map field
+func mapSheet(sheetName string, obj interface{}, field string, key string) sheetInfo {
+	return sheetInfo{sheetName: sheetName, obj: obj, loader: mapLoader(field, key), field: field, key: key}
+}
+
+// 按行顺序填充到GameDB的slice field
+func arraySheet(sheetName string, obj interface{}, field string) sheetInfo {
+	return sheetInfo{sheetName: sheetName, obj: obj, loader: arrayLoader(field), field: field}
+}
+
+func (registry *Registry) register(excelName string, sheetInfos ...sheetInfo) {
+	registry.files = append(registry.files, fileInfo{excelName, sheetInfos})
 }
 
-func getfileModTime(filePath string) int64 {
-	if nil == fileModTime {
-		return 0
+// 只包含指定表格文件的注册表(e.g : 工具只加载部分配置), 未注册的文件忽略
+func (registry *Registry) Select(excelNames ...string) *Registry {
+	selected := &Registry{}
+	for _, excelInfo := range registry.files {
+		for _, excelName := range excelNames {
+			if excelInfo.excelName == excelName {
+				selected.files = append(selected.files, excelInfo)
+				break
+			}
+		}
 	}
-	return fileModTime[filePath]
+	return selected
 }
 
-func setfileModTime(filePath string, nanoTime int64) {
-	if nil == fileModTime {
-		fileModTime = make(fileRecords)
+// 注册的表格文件名
+func (registry *Registry) ExcelNames() []string {
+	names := make([]string, 0, len(registry.files))
+	for _, excelInfo := range registry.files {
+		names = append(names, excelInfo.excelName)
 	}
-	fileModTime[filePath] = nanoTime
+	return names
 }
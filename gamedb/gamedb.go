@@ -1,31 +1,53 @@
 package gamedb
 
+import "parser/gamelib/censor"
+
 const CellWidth = 72
 const CellHeight = 48
 
 type onDemand map[string]map[string]interface{}
 
-var sceneMaps map[int]*SceneMap
-
-var gameDB *GameDB
-
-func newGameDB() *GameDB {
-	return &GameDB{}
+func newGameDB(logger Logger) *GameDB {
+	return &GameDB{
+		report: newLoadReport(),
+		logger: logger,
+	}
 }
 
 type GameDB struct {
 	OnDemandData onDemand
 
-	Items      map[int]*Item  `client:"items,map" mapKey:"Id"`
-	Scenes     map[int]*Scene `client:"scenes,map" mapKey:"Id"`
-	OtherDatas []*OtherData   `client:"OtherDatas,array" mapKey:"Id"`
+	report *LoadReport   // 加载报告(不参与gob序列化)
+	words  *censor.Store // 敏感词库,支持热更新
+	scenes *sceneStore   // 地图仓库
+	logger Logger        // 加载日志
+
+	Scenes map[int]*Scene `client:"scenes,map" mapKey:"Id"`
+
+	// 注册表格的数据, 由sheettool gen生成
+	// sheettool gen fields begin
+	Items      map[int]*Item `client:"items,map" mapKey:"Id"`
+	OtherDatas []*OtherData  `client:"OtherDatas,array" mapKey:"Id"`
+	// sheettool gen fields end
+}
+
+func (gameDB *GameDB) logf(format string, args ...interface{}) {
+	if nil == gameDB.logger {
+		stdLogger{}.Printf(format, args...)
+		return
+	}
+	gameDB.logger.Printf(format, args...)
+}
+
+// 清空已加载的数据,保留报告和日志
+func (gameDB *GameDB) reset() {
+	*gameDB = GameDB{report: gameDB.report, logger: gameDB.logger}
 }
 
 type SceneMap struct {
-	Id          int
-	Name        string
-	Width       int
-	Height      int
-	RoadFlags   map[int32]int8
-	walkableMap map[int32]bool
+	Id     int
+	Name   string
+	Width  int     // 宽度(格子数)
+	Height int     // 高度(格子数)
+	flags  []uint8 // Width*Height的RoadFlags网格,按行存储
 }
@@ -0,0 +1,205 @@
+package gamedb
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 多列字段: field带group tag(不需要col tag)时, 由前缀为组名的多个列组成.
+//   Rewards []int      `group:"reward"`             reward1, reward2, reward3 ...
+//   Rewards ItemInfos  `group:"reward" sep:","`     reward1(1001,5), reward2 ... 每列为一个元素
+//   Rewards ItemInfos  `group:"reward"`             rewardId1, rewardCount1, rewardId2 ... 元素的field分列填写
+//   Attrs   []PropInfo `group:"attr"`               attrKey1, attrValue1, attrKey2 ...
+//   Attr    PropInfo   `group:"attr"`               attrKey, attrValue
+//   Levels  [3]int     `group:"lv"`                 lv1, lv2, lv3
+// 元素序号从1开始, 结构体field的列名为col tag或field名(不区分大小写).
+// slice末尾没有数据的元素去除, 中间没有数据的元素为零值. sep tag用于解析每个单元格.
+
+// 列名是否属于field的组, 返回元素下标(非slice/array为-1)和结构体field下标(整个元素为-1)
+func matchGroup(field reflect.StructField, colName string) (int, int, bool) {
+	group := field.Tag.Get("group")
+	if len(group) == 0 || !strings.HasPrefix(colName, group) {
+		return 0, 0, false
+	}
+	rest := colName[len(group):]
+
+	// 末尾的序号
+	digits := len(rest)
+	for digits > 0 && rest[digits-1] >= '0' && rest[digits-1] <= '9' {
+		digits--
+	}
+	subName, number := rest[:digits], rest[digits:]
+
+	elem := -1
+	elemT := field.Type
+	switch field.Type.Kind() {
+	case reflect.Slice, reflect.Array:
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 1 || (field.Type.Kind() == reflect.Array && n > field.Type.Len()) {
+			return 0, 0, false
+		}
+		elem = n - 1
+		elemT = field.Type.Elem()
+	default:
+		if len(number) > 0 {
+			return 0, 0, false
+		}
+	}
+
+	if len(subName) == 0 {
+		return elem, -1, elem >= 0
+	}
+
+	if elemT.Kind() == reflect.Ptr {
+		elemT = elemT.Elem()
+	}
+	if elemT.Kind() != reflect.Struct || elemT == timeType {
+		return 0, 0, false
+	}
+	for i := 0; i < elemT.NumField(); i++ {
+		sub := elemT.Field(i)
+		if !sub.IsExported() {
+			continue
+		}
+		name := sub.Tag.Get("col")
+		if len(name) == 0 {
+			name = sub.Name
+		}
+		if strings.EqualFold(name, subName) {
+			return elem, i, true
+		}
+	}
+	return 0, 0, false
+}
+
+// 返回列对应的值(按需扩展slice,分配指针)和解析使用的分隔符
+func groupTarget(fieldV reflect.Value, info *fieldInfo) (reflect.Value, string) {
+	target := fieldV
+	seps := info.field.Tag.Get("sep")
+
+	if info.elem >= 0 {
+		if target.Kind() == reflect.Slice {
+			for target.Len() <= info.elem {
+				target.Set(reflect.Append(target, newElem(target.Type().Elem())))
+			}
+		}
+		target = target.Index(info.elem)
+	}
+
+	if info.sub >= 0 {
+		if target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				target.Set(reflect.New(target.Type().Elem()))
+			}
+			target = target.Elem()
+		}
+		if sub := target.Type().Field(info.sub).Tag.Get("sep"); len(sub) > 0 {
+			seps = sub
+		}
+		target = target.Field(info.sub)
+	}
+	return target, seps
+}
+
+// 指针元素分配内存,保证slice中没有nil
+func newElem(t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem())
+	}
+	return reflect.New(t).Elem()
+}
+
+var decoderType = reflect.TypeOf((*Decoder)(nil)).Elem()
+
+// 多列字段的默认列(EncodeRow使用): slice按元素个数, array按长度输出元素;
+// 元素为结构体且没有sep tag和Decoder时(或字段本身为结构体)每个field一列, 否则每个元素一列
+func groupColumns(structV reflect.Value, idx int) ([]*fieldInfo, error) {
+	field := structV.Type().Field(idx)
+	group := field.Tag.Get("group")
+	fieldV := structV.Field(idx)
+
+	elemT := field.Type
+	elems := []int{-1}
+	isList := field.Type.Kind() == reflect.Slice || field.Type.Kind() == reflect.Array
+	if isList {
+		elemT = field.Type.Elem()
+		elems = elems[:0]
+		// 空slice输出第一个元素的空列, 解析后仍为空slice
+		for i := 0; i < fieldV.Len() || i == 0; i++ {
+			elems = append(elems, i)
+		}
+	}
+	if elemT.Kind() == reflect.Ptr {
+		elemT = elemT.Elem()
+	}
+
+	isStruct := elemT.Kind() == reflect.Struct && elemT != timeType
+	split := isStruct && (!isList || (len(field.Tag.Get("sep")) == 0 && !reflect.PtrTo(elemT).Implements(decoderType)))
+	if !isStruct && !isList {
+		return nil, fmt.Errorf("group field %s needs a slice, array or struct", field.Name)
+	}
+
+	var infos []*fieldInfo
+	for _, elem := range elems {
+		suffix := ""
+		if elem >= 0 {
+			suffix = strconv.Itoa(elem + 1)
+		}
+		if !split {
+			infos = append(infos, &fieldInfo{idx: idx, field: &field, group: group, elem: elem, sub: -1, colName: group + suffix})
+			continue
+		}
+		for i := 0; i < elemT.NumField(); i++ {
+			sub := elemT.Field(i)
+			if !sub.IsExported() {
+				continue
+			}
+			name := sub.Tag.Get("col")
+			if len(name) == 0 {
+				name = sub.Name
+			}
+			infos = append(infos, &fieldInfo{idx: idx, field: &field, group: group, elem: elem, sub: i, colName: group + name + suffix})
+		}
+	}
+	return infos, nil
+}
+
+// 多列字段的默认列和单元格. 解析时slice末尾没有数据的元素会被去除,nil元素会分配内存, 这两种元素无法还原.
+func encodeGroup(structV reflect.Value, idx int, loc *time.Location) ([]string, []string, error) {
+	infos, err := groupColumns(structV, idx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fieldV := structV.Field(idx)
+	if fieldV.Kind() == reflect.Ptr && fieldV.IsNil() {
+		return nil, nil, fmt.Errorf("%s is nil", structV.Type().Field(idx).Name)
+	}
+	isSlice := fieldV.Kind() == reflect.Slice
+	lastHasData := false
+
+	cols := make([]string, 0, len(infos))
+	cells := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.elem >= 0 && info.elem < fieldV.Len() && fieldV.Type().Elem().Kind() == reflect.Ptr && fieldV.Index(info.elem).IsNil() {
+			return nil, nil, fmt.Errorf("element %d is nil", info.elem)
+		}
+		cell, err := encodeColumn(structV, info, loc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("column %s : %w", info.colName, err)
+		}
+		if info.elem == fieldV.Len()-1 && len(cell) > 0 {
+			lastHasData = true
+		}
+		cols = append(cols, info.colName)
+		cells = append(cells, cell)
+	}
+
+	if isSlice && fieldV.Len() > 0 && !lastHasData {
+		return nil, nil, fmt.Errorf("element %d has no data", fieldV.Len()-1)
+	}
+	return cols, cells, nil
+}
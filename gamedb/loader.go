@@ -2,34 +2,36 @@ package gamedb
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math"
 	"os"
+	"parser/gamelib/censor"
 	"parser/gamelib/pcommon"
-	"parser/util"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
-
-	textcensor "github.com/kai1987/go-text-censor"
-	"github.com/tealeg/xlsx"
 )
 
-var startRow int = 3 // Sheet起始行
-var startCol int = 2 // Sheet起始列
+const reportSectionExcel = "excel"
+
+const defaultStartRow = 3 // Sheet标题行
+const defaultStartCol = 2 // Sheet起始列
 
 type fieldInfo struct {
 	idx     int                  // 列索引
 	field   *reflect.StructField // 列对应objs的field
-	group   string               // 组名(暂时用不到)
+	group   string               // 多列字段的组名(group tag)
+	elem    int                  // 多列字段: 列对应的元素下标, -1为非slice/array
+	sub     int                  // 多列字段: 列对应的结构体field下标, -1为整个元素
 	colName string               // sheet列名
 }
 
@@ -40,93 +42,96 @@ type sheetInfo struct {
 	sheetName string
 	obj       interface{}                        // 用于存放Sheet每行数据的数据结构
 	loader    func(*GameDB, []interface{}) error // 填充objs到GameDB的方法(arrayLoader,mapLoader...)
+	field     string                             // loader填充的GameDB field(代码生成使用), 自定义loader为空
+	key       string                             // mapLoader的key, arrayLoader为空
+}
+
+type LoadOptions struct {
+	ExcelWorkers int          // 表格并发加载数量, <=0时为GOMAXPROCS
+	Scene        SceneOptions // 地图加载方式
 }
 
+// 使用SetExcelWorkers和SetSceneOptions设置的选项加载
 func Load(basePath string) (*GameDB, error) {
-	f, err := os.Stat(basePath)
+	return LoadContext(context.Background(), basePath, DefaultLoadOptions())
+}
+
+// 使用默认注册表加载basePath, 成功后作为包级GetSceneMap使用的GameDB.
+// 需要同时加载多套配置时使用NewLoader.
+func LoadContext(ctx context.Context, basePath string, opts LoadOptions) (*GameDB, error) {
+	loader := NewLoader(LoaderOptions{
+		Paths:   LoadPaths{Base: basePath},
+		Workers: opts.ExcelWorkers,
+		Scene:   opts.Scene,
+	})
+	gameDB, err := loader.Load(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if f.IsDir() {
-		return loadExcel(basePath, "gamedb.dat")
-	}
-	return loadFile(basePath)
+	setDefaultGameDB(gameDB)
+	return gameDB, nil
 }
 
-func loadExcel(basePath string, datFileName string) (*GameDB, error) {
-
-	gameDB = newGameDB()
-
+func (loader *Loader) loadExcel(ctx context.Context, gameDB *GameDB, paths LoadPaths) error {
 	// 优先加载gamedb.dat文件
-	datFilePath := filepath.Join(basePath, datFileName)
-	if f, err := os.Stat(datFilePath); nil == err && !f.IsDir() {
-		pcommon.PrintMemStats("loadExcel Alloc before loadDatFile: ")
-		if err := gameDB.loadFile(datFilePath); err != nil {
-			fmt.Printf("load .dat file error : %s\n", err.Error())
-			gameDB = newGameDB()
+	datLoaded := false
+	if loader.opts.Cache != CacheOff {
+		if f, err := os.Stat(paths.Dat); nil == err && !f.IsDir() {
+			pcommon.PrintMemStats("loadExcel Alloc before loadDatFile: ")
+			if err := gameDB.loadFile(ctx, paths.Dat); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				gameDB.logf("load .dat file error : %s\n", err.Error())
+				gameDB.reset()
+			} else {
+				// 只有本Loader写入的.dat才包含modTimes记录的表格数据(其他进程可能覆盖了.dat)
+				datLoaded = f.ModTime().UnixNano() == loader.datModTime
+			}
+			runtime.GC()
+			pcommon.PrintMemStats("loadExcel Alloc after loadDatFile GC: ")
 		}
-		runtime.GC()
-		pcommon.PrintMemStats("loadExcel Alloc after loadDatFile GC: ")
 	}
 
-	hasChange, err := gameDB.loadExcels(filepath.Join(basePath, "excels"))
-	if err != nil {
-		return nil, err
+	// .dat未加载时所有表格都需要重新读取
+	if !datLoaded {
+		loader.modTimes = make(fileRecords)
 	}
 
-	// 动态数据(不以配置文件的形式加入客户端,在游戏运行时客户端动态请求服务器数据,onDemandData.json由jenkins生成)
-	if temp, err := loadOnDemandData(basePath); nil == err {
-		gameDB.OnDemandData = temp
+	modifyTimes, err := loader.loadExcels(ctx, gameDB, paths.Excels)
+	if err != nil {
+		return err
 	}
-
-	if hasChange {
-		gameDB.createFile(datFilePath)
+	if len(modifyTimes) == 0 || loader.opts.Cache != CacheReadWrite {
+		return nil
 	}
 
-	// 组装(生成冗余的,但对于某些module方便的数据结构)
-	gameDB.Patch()
-
-	if err := gameDB.Check(); err != nil {
-		return nil, err
+	if err := gameDB.createFile(paths.Dat); err != nil {
+		return fmt.Errorf("create %s has err : %w", paths.Dat, err)
 	}
-
-	if err := loadScenes(gameDB, basePath); err != nil {
-		return nil, err
+	f, err := os.Stat(paths.Dat)
+	if err != nil {
+		return err
 	}
 
-	// 加载敏感词或短语
-	if err := loadSensitivePhrases(filepath.Join(basePath, "filtertext.txt")); err != nil {
-		return nil, err
+	// .dat写入成功后才记录修改时间: 下次Load从.dat得到这些表格的数据, 跳过未修改的表格
+	for excelName, modifyTime := range modifyTimes {
+		loader.modTimes[excelName] = modifyTime
 	}
-
-	fmt.Println("加载gameDB成功!")
-	return gameDB, nil
+	loader.datModTime = f.ModTime().UnixNano()
+	return nil
 }
 
-func loadOnDemandData(basePath string) (onDemand, error) {
+func loadOnDemandData(ctx context.Context, onDemandFilePath string) (onDemand, error) {
 	onDemandData := make(map[string]map[string]interface{})
 
-	fInfo, err := os.Stat(basePath)
-	if err != nil {
-		fmt.Printf("loadOnDemandData() basePath not found\n")
-		return nil, fmt.Errorf("loadOnDemandData() basePath not found")
-	}
-
-	var onDemandFilePath string
-	if fInfo.IsDir() {
-		onDemandFilePath = basePath + "/onDemandData.json"
-	} else {
-		onDemandFilePath = filepath.Dir(basePath) + "/onDemandData.json"
-	}
-
 	f, err := os.Open(onDemandFilePath)
 	if err != nil {
-		fmt.Printf("loadOnDemandData() open %s error : %v\n", onDemandFilePath, err)
 		return nil, fmt.Errorf("loadOnDemandData() open %s error : %v", onDemandFilePath, err)
 	}
 	defer f.Close()
 
-	b, err := ioutil.ReadAll(f)
+	b, err := ioutil.ReadAll(contextReader{ctx, f})
 	if err != nil {
 		return nil, fmt.Errorf("loadOnDemandData() Read %s error : %v", onDemandFilePath, err)
 	}
@@ -142,92 +147,85 @@ func loadOnDemandData(basePath string) (onDemand, error) {
 	return onDemandData, nil
 }
 
-func loadScenes(gameDB *GameDB, basePath string) error {
+func loadScenes(ctx context.Context, gameDB *GameDB, sceneDir string, opts SceneOptions, cache CachePolicy) error {
 	if nil == gameDB {
 		return fmt.Errorf("loadScenes() invalid param")
 	}
 
-	scenePath := filepath.Join(basePath, "scenes/map_%d.json")
-	mapIds := gameDB.getSceneMapIds()
-	var info string = ""
-	var waiter sync.WaitGroup
-	var errChan chan error = make(chan error, len(mapIds))
-	var dataChan chan *SceneMap = make(chan *SceneMap, len(mapIds))
-
-	waiter.Add(len(mapIds))
-	for _, id := range mapIds {
-		go func(mapId int) {
-			if sceneMap, err := loadSceneMap(makeMapPath(scenePath, mapId), mapId); err != nil {
-				errChan <- err
-			} else {
-				dataChan <- sceneMap
-			}
-			waiter.Done()
-		}(id)
-	}
-	waiter.Wait()
-
-	go func() {
-		close(errChan)
-	}()
+	scenePath := filepath.Join(sceneDir, "map_%d.json")
+	store := newSceneStore(scenePath, gameDB.getSceneMapIds(), opts)
+	store.cache = cache
 
-	// 关闭通道后,不会阻塞,也不会无限循环. range对chan操作有封装
-	for err := range errChan {
-		info += fmt.Sprintf("%s,\n", err.Error())
+	if store.opts.Lazy {
+		// 懒加载: 每张地图加载时单独分析,问题记录到报告,不中断游戏
+		points := gameDB.scenePoints()
+		store.onLoad = func(sceneMap *SceneMap) {
+			gameDB.checkSceneMap(sceneMap, points[sceneMap.Id])
+		}
+		gameDB.scenes = store
+		return nil
 	}
 
-	if info != "" {
-		return fmt.Errorf(info)
+	loaded, err := store.preload(ctx)
+	if err != nil {
+		return err
 	}
 
-	go func() {
-		close(dataChan)
-	}()
+	// 连通性分析和坐标点校验
+	if err := gameDB.checkScenes(loaded); err != nil {
+		return err
+	}
 
-	for sceneMap := range dataChan {
-		if nil == sceneMaps {
-			sceneMaps = make(map[int]*SceneMap)
-		}
-		sceneMaps[sceneMap.Id] = sceneMap
+	count, memUsed := store.stats()
+	gameDB.Report().Add(ReportInfo, reportSectionScene, "%d scene maps preloaded, grid memory %d KiB", count, memUsed/1024)
+	if store.opts.MemoryBudget > 0 && memUsed > store.opts.MemoryBudget {
+		gameDB.Report().Add(ReportWarn, reportSectionScene, "preloaded scene maps exceed memory budget %d KiB, budget only applies to lazy loading",
+			store.opts.MemoryBudget/1024)
 	}
 
+	gameDB.scenes = store
+
 	return nil
 }
 
 // 加载map_****.json
-func loadSceneMap(scenePath string, sceneId int) (*SceneMap, error) {
-	b, err := ioutil.ReadFile(scenePath)
+// json内容未变化时从同目录的二进制缓存加载,跳过json解析.
+// 与.dat相同, 只有CacheReadWrite时才写入二进制缓存, CacheOff时不读取.
+func loadSceneMap(ctx context.Context, scenePath string, sceneId int, cache CachePolicy) (*SceneMap, error) {
+	b, err := readFileContext(ctx, scenePath)
 	if err != nil {
 		fmt.Printf("loadSceneMap() read file %s, error : %v\n", scenePath, err)
 		return nil, err
 	}
 
-	sceneMap := SceneMap{}
-	// Unmarshal() 会对 SceneMap{} 中的map结构分配内存,详见F12.
-	if err := json.Unmarshal(b, &sceneMap); err != nil {
-		fmt.Printf("loadSceneMap() json.Unmarshal() file %s, err : %v\n", scenePath, err)
+	hash := sha256.Sum256(b)
+	binPath := sceneBinPath(scenePath)
+	if cache != CacheOff {
+		if sceneMap := loadSceneBinary(binPath, hash); sceneMap != nil {
+			return sceneMap, nil
+		}
+	}
+
+	sceneMap, err := decodeSceneMapFile(b, sceneId)
+	if err != nil {
+		fmt.Printf("loadSceneMap() decode file %s, err : %v\n", scenePath, err)
 		return nil, err
 	}
 
-	if len(sceneMap.RoadFlags) < 1 {
-		fmt.Printf("loadSceneMap() Load no Walkable point in map : %s\n", scenePath)
-		return nil, fmt.Errorf("config has no roadFlags")
+	if cache == CacheReadWrite {
+		if err := saveSceneBinary(binPath, sceneMap, hash); err != nil {
+			fmt.Printf("loadSceneMap() save binary %s, err : %v\n", binPath, err)
+		}
 	}
 
-	sceneMap.Width = int(math.Ceil(float64(sceneMap.Width) / CellWidth))
-	sceneMap.Height = int(math.Ceil(float64(sceneMap.Height) / CellHeight))
+	return sceneMap, nil
+}
 
-	// 重新计算并生成walkableMap
-	walkableMap := make(map[int32]bool, len(sceneMap.RoadFlags))
-	for k, v := range sceneMap.RoadFlags {
-		x, y := k/1000, k%1000
-		walkableMap[x<<16|y] = v&1 == 1
-		if x<<16|y < 0 {
-			fmt.Printf("x : %d, y : %d, k : %d\n", x, y, k)
-		}
-		delete(sceneMap.RoadFlags, k)
+func decodeSceneMapFile(b []byte, sceneId int) (*SceneMap, error) {
+	sceneMap, err := decodeSceneMap(b)
+	if err != nil {
+		return nil, err
 	}
-	sceneMap.walkableMap = walkableMap
 
 	// 文件不提供Id和Name,则生成
 	if sceneMap.Id < 1 {
@@ -238,60 +236,46 @@ func loadSceneMap(scenePath string, sceneId int) (*SceneMap, error) {
 		sceneMap.Name = fmt.Sprintf("scene_%d", sceneMap.Id)
 	}
 
-	return &sceneMap, nil
+	return sceneMap, nil
 }
 
 func makeMapPath(basePath string, sceneId int) string {
 	return fmt.Sprintf(basePath, sceneId)
 }
 
-func loadSensitivePhrases(filterFilePath string) error {
-	err := textcensor.InitWordsByPath(filterFilePath, false)
-	if err != nil {
-		return err
-	}
-
-	defaultPunctuation := "0123456789abcdefghijklmnopqrstuvwxyz !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~，。？；：”’￥（）——、！……"
-	textcensor.SetPunctuation(defaultPunctuation) // 忽略标点符号
-	return nil
-}
-
-func loadFile(basePath string) (*GameDB, error) {
-
-	gameDB = newGameDB()
+// 敏感词匹配时忽略的字符(词库中出现的字母数字不会被忽略)
+const sensitiveSkip = "0123456789abcdefghijklmnopqrstuvwxyz !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~，。？；：”’￥（）——、！……\u3000\t"
 
-	if err := gameDB.loadFile(basePath); err != nil {
-		return nil, err
+// 加载敏感词: source为分类词库目录(filtertext/)或单个词库文件(filtertext.txt)
+func loadSensitivePhrases(ctx context.Context, gameDB *GameDB, source string) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	if temp, err := loadOnDemandData(basePath); nil == err {
-		gameDB.OnDemandData = temp
+	load := func() (*censor.Library, error) {
+		return censor.LoadSingle(source, "default", censor.Meta{Skip: sensitiveSkip})
 	}
-
-	gameDB.Patch()
-
-	if err := gameDB.Check(); err != nil {
-		return nil, err
-	}
-
-	dirPath := filepath.Dir(basePath)
-
-	if err := loadScenes(gameDB, dirPath); err != nil {
-		return nil, err
+	if f, err := os.Stat(source); nil == err && f.IsDir() {
+		load = func() (*censor.Library, error) {
+			return censor.LoadDir(source)
+		}
 	}
 
-	if err := loadSensitivePhrases(filepath.Join(dirPath, "filtertext.txt")); err != nil {
-		return nil, err
+	store, err := censor.NewStore(source, load)
+	if err != nil {
+		return err
 	}
 
-	return gameDB, nil
+	gameDB.words = store
+	gameDB.Report().Add(ReportInfo, reportSectionCensor, "%s loaded, %s", source, store.Stats())
+	return nil
 }
 
-func (gameDB *GameDB) loadFile(datFilePath string) error {
+func (gameDB *GameDB) loadFile(ctx context.Context, datFilePath string) error {
 	startTime := time.Now()
 
 	defer func() {
-		fmt.Println("GameDB loadFile used time(seconds) : ", time.Since(startTime).Seconds())
+		gameDB.logf("GameDB loadFile used time(seconds) : %f\n", time.Since(startTime).Seconds())
 	}()
 
 	f, err := os.Open(datFilePath)
@@ -301,7 +285,7 @@ func (gameDB *GameDB) loadFile(datFilePath string) error {
 
 	defer f.Close() // 系统资源，不被GC,手动释放
 
-	reader := bufio.NewReader(f)
+	reader := bufio.NewReader(contextReader{ctx, f})
 	decoder := gob.NewDecoder(reader)
 	return decoder.Decode(&gameDB)
 }
@@ -310,247 +294,433 @@ func (gameDB *GameDB) createFile(filePath string) error {
 	now := time.Now()
 
 	defer func() {
-		fmt.Printf("create %s use time : %f\n", filePath, time.Since(now).Seconds())
+		gameDB.logf("create %s use time : %f\n", filePath, time.Since(now).Seconds())
 	}()
 
-	f, err := os.Create(filePath)
+	// 写入临时文件后替换, 写入失败时不留下不完整的.dat
+	f, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer os.Remove(f.Name())
 
 	w := bufio.NewWriter(f)
 	enc := gob.NewEncoder(w)
-	enc.Encode(gameDB)
+	if err := enc.Encode(gameDB); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filePath)
+}
 
-	return w.Flush()
+// 以sheet为单位并发解析
+type sheetJob struct {
+	excelName string
+	book      workbook
+	info      sheetInfo
+	objs      []interface{}
+	refs      []cellRef // 类型行中ref列的单元格
+	err       error
+	used      time.Duration
 }
 
-func (gameDB *GameDB) loadExcels(basePath string) (bool, error) {
-	var counter int
-	var threadError error
-	var waiter sync.WaitGroup
+// 工作簿和sheet由有限的goroutine并发解析, loader在解析完成后按注册顺序串行执行,不会并发修改GameDB.
+// 所有表格的错误都会收集后一起返回. 返回重新加载的表格的修改时间, 没有修改的表格时为空.
+func (loader *Loader) loadExcels(ctx context.Context, gameDB *GameDB, basePath string) (map[string]int64, error) {
 	startTime := time.Now()
+	sampler := pcommon.StartMemSampler(10 * time.Millisecond) // 统计加载表格的内存峰值
 
 	defer func() {
-		fmt.Printf("GameDB loadExcels used time(seconds) : %f\n", time.Since(startTime).Seconds())
+		gameDB.logf("GameDB loadExcels used time(seconds) : %f\n", time.Since(startTime).Seconds())
+		peak := pcommon.PrintPeakMemStats("loadExcels", sampler)
+		gameDB.Report().Add(ReportInfo, reportSectionExcel, "loadExcels used %s, peak heap %d MiB", time.Since(startTime), peak)
 	}()
 
-	for _, excelInfo := range fileInfos {
+	var changed []fileInfo
+	modifyTimes := make(map[string]int64)
+	for _, excelInfo := range loader.opts.Registry.files {
 		excelPath := filepath.Join(basePath, excelInfo.excelName)
 
 		f, err := os.Stat(excelPath)
 		if err != nil {
-			return false, fmt.Errorf("stat file ( %s ) has err : %s", excelPath, err)
+			return nil, fmt.Errorf("stat file ( %s ) has err : %s", excelPath, err)
 		}
 
 		modifyTime := f.ModTime().UnixNano() // 时间戳（纳秒）
 
-		if getfileModTime(excelInfo.excelName) == modifyTime {
-			fmt.Printf("file ( %s ) not modified.\n", excelInfo.excelName)
+		if loader.modTimes[excelInfo.excelName] == modifyTime {
+			gameDB.logf("file ( %s ) not modified.\n", excelInfo.excelName)
 			continue
 		}
 
-		setfileModTime(excelInfo.excelName, modifyTime)
-		counter++
+		modifyTimes[excelInfo.excelName] = modifyTime
+		changed = append(changed, excelInfo)
+	}
 
-		waiter.Add(1)
-		go func(excelPath string, excelInfo fileInfo) {
-			startTime := time.Now()
-			if err := gameDB.loadExcel(excelPath, excelInfo.sheetInfos); err != nil {
-				threadError = err
-				fmt.Printf("GameDB load %s has error, error : %s.\n", excelInfo.excelName, err)
-			}
-			fmt.Printf("GameDB load %s complete, used time(seconds) : %s.\n", excelInfo.excelName, time.Since(startTime))
-			waiter.Done()
-		}(excelPath, excelInfo)
+	if len(loader.opts.Registry.files) == 0 {
+		return nil, fmt.Errorf("no excels be registered")
+	}
+	if len(changed) == 0 {
+		return nil, nil
 	}
 
-	waiter.Wait()
+	workers := loader.opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// 打开工作簿(xlsx读取共享字符串和样式)
+	books := make([]workbook, len(changed))
+	openErrors := make([]error, len(changed))
+	runWorkers(ctx, workers, len(changed), func(i int) {
+		books[i], openErrors[i] = openWorkbook(ctx, filepath.Join(basePath, changed[i].excelName))
+	})
+	defer func() {
+		for _, book := range books {
+			if book != nil {
+				book.close()
+			}
+		}
+	}()
 
-	if threadError != nil {
-		return false, threadError
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	if counter == 0 {
-		return false, fmt.Errorf("no excels be loaded")
+	var errs LoadErrors
+	var jobs []*sheetJob
+	for i, excelInfo := range changed {
+		if openErrors[i] != nil {
+			errs = append(errs, fmt.Errorf("GameDB load %s has error : %w", excelInfo.excelName, openErrors[i]))
+			continue
+		}
+		for _, info := range excelInfo.sheetInfos {
+			jobs = append(jobs, &sheetJob{excelName: excelInfo.excelName, book: books[i], info: info})
+		}
 	}
 
-	fmt.Printf("excels totally loaded : %d.\n", counter)
-	return true, nil
-}
+	runWorkers(ctx, workers, len(jobs), func(i int) {
+		job := jobs[i]
+		startTime := time.Now()
+		rows, err := job.book.rows(job.info.sheetName)
+		if err == nil {
+			job.objs, job.refs, err = gameDB.readSheet(job.info.sheetName, rows, job.info.obj, loader.opts.StartRow, loader.opts.StartCol, loader.opts.Location)
+			rows.close() // 解析出错时可能没有读完
+		}
+		job.err = err
+		job.used = time.Since(startTime)
+	})
 
-func (gameDB *GameDB) loadExcel(excelPath string, sheetInfos []sheetInfo) error {
-	xlsxFile, err := xlsx.OpenFile(excelPath)
-	if err != nil {
-		return err
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	for _, sheetInfo := range sheetInfos {
-		if _, ok := xlsxFile.Sheet[sheetInfo.sheetName]; !ok {
-			return fmt.Errorf("no sheet ( %s ) found", sheetInfo.sheetName)
+	// loader串行执行
+	for _, job := range jobs {
+		if job.err == nil {
+			job.err = job.info.loader(gameDB, job.objs)
 		}
+		job.objs = nil
+		if job.err != nil {
+			gameDB.logf("GameDB load %s sheet ( %s ) has error, error : %s.\n", job.excelName, job.info.sheetName, job.err)
+			errs = append(errs, fmt.Errorf("GameDB load %s sheet ( %s ) has error : %w", job.excelName, job.info.sheetName, job.err))
+			continue
+		}
+		gameDB.logf("GameDB load %s sheet ( %s ) complete, used time(seconds) : %s.\n", job.excelName, job.info.sheetName, job.used)
+	}
 
-		sheet := xlsxFile.Sheet[sheetInfo.sheetName]
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
-		objs, err := gameDB.readSheet(sheet, sheetInfo.obj, startRow, startCol)
-		if err != nil {
-			return err
+	// 引用其他表的单元格在所有loader执行后检查
+	for _, job := range jobs {
+		for _, err := range gameDB.checkRefs(job.info.sheetName, job.refs) {
+			errs = append(errs, fmt.Errorf("GameDB load %s sheet ( %s ) has error : %w", job.excelName, job.info.sheetName, err))
 		}
+		job.refs = nil
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
-		if err := sheetInfo.loader(gameDB, objs); err != nil {
-			return err
-		}
+	gameDB.logf("excels totally loaded : %d, sheets : %d.\n", len(changed), len(jobs))
+	return modifyTimes, nil
+}
+
+// 用workers个goroutine执行fn(0)...fn(n-1),全部完成后返回.
+// ctx取消后不再分发新的任务,等待执行中的任务结束后返回.
+func runWorkers(ctx context.Context, workers int, n int, fn func(i int)) {
+	if workers > n {
+		workers = n
 	}
 
-	return nil
+	indexes := make(chan int)
+	var waiter sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	waiter.Wait()
 }
 
 // 表格填充格式:
 // 从第3行,第2列开始填写.
-func (gameDB *GameDB) readSheet(sheet *xlsx.Sheet, obj interface{}, startRow int, startCol int) ([]interface{}, error) {
+// 逐行读取并直接解析为obj,不在内存中保留整个sheet.
+func (gameDB *GameDB) readSheet(sheetName string, rows rowReader, obj interface{}, startRow int, startCol int, loc *time.Location) ([]interface{}, []cellRef, error) {
 
 	objT := reflect.TypeOf(obj)
 	var result []interface{} = make([]interface{}, 0)
 
 	if !(objT.Kind() == reflect.Ptr && objT.Elem().Kind() == reflect.Struct) {
-		return nil, fmt.Errorf("obj must be a struct")
+		return nil, nil, fmt.Errorf("obj must be a struct")
 	}
 
-	if len(sheet.Rows) <= startRow || len(sheet.Cols) <= startCol {
-		return nil,
-			fmt.Errorf("sheet ( %s ) not meets the request, rows ( %d ), cols ( %d )", sheet.Name, len(sheet.Rows), len(sheet.Cols))
-	}
+	var header []string  // 标题行(colName)
+	var typeRow []string // 类型行(标题行的上一行)
+	var colInfos columnInfos
+	var refCols map[int]string // ref列(列下标 -> 引用的GameDB field)
+	var refs []cellRef
+	var maxCol int
+	rowCount := 0
+	lastRow := startRow - 1 // 上一个数据行
+
+	for {
+		i, row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rowCount = i + 1
+
+		if i < startRow-1 {
+			if i == startRow-2 {
+				typeRow = row
+			}
+			continue
+		}
+
+		if i == startRow-1 {
+			header = row
+			if len(header) <= startCol {
+				return nil, nil,
+					fmt.Errorf("sheet ( %s ) not meets the request, title row ( %d ), cols ( %d )", sheetName, startRow, len(header))
+			}
+
+			var colRecords columnRecords
+			colInfos, colRecords, maxCol = gameDB.collectColumnInfo(header, objT, startCol)
+
+			if len(colInfos) == 0 {
+				return nil, nil, fmt.Errorf("no column found for current sheet : %s", sheetName)
+			}
+
+			if typeRow != nil && isTypeRow(typeRow, startCol) {
+				if refCols, err = checkTypeRow(sheetName, typeRow, colInfos); err != nil {
+					return nil, nil, err
+				}
+			}
+
+			isPass, pField := gameDB.checkAllFieldFoundColumn(objT, colRecords)
+			if !isPass {
+				if pField != nil {
+					return nil, nil, fmt.Errorf("sheet ( %s ) not found column : %s\n, update excels and try again", sheetName, pField.Name)
+				}
+			}
+			continue
+		}
+
+		if nil == header {
+			return nil, nil, fmt.Errorf("sheet ( %s ) not meets the request, title row ( %d ) not found", sheetName, startRow)
+		}
+
+		// 表格不允许有空行. 真正的数据在colName(title)下一行
+		if i != lastRow+1 {
+			return nil, nil, fmt.Errorf("empty row : sheet ( %s ) empty row at %d row", sheetName, lastRow+2)
+		}
+		if len(row) == 0 {
+			return nil, nil, fmt.Errorf("empty row : sheet ( %s ) empty row at %d row", sheetName, i+1)
+		}
+		lastRow = i
+
+		objV, err := gameDB.decodeRow(sheetName, i, row, objT, colInfos, maxCol, startCol, loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, objV)
 
-	colInfos, colRecords, maxCol := gameDB.collectColumnInfo(sheet, objT, startRow, startCol)
+		for j, target := range refCols {
+			if value, ok := columnValue(reflect.ValueOf(objV).Elem(), colInfos[j]); ok {
+				refs = append(refs, cellRef{row: i, col: j, target: target, value: value})
+			}
+		}
+	}
 
-	if len(colInfos) == 0 {
-		return nil, fmt.Errorf("no column found for current sheet : %s", sheet.Name)
+	if nil == header || len(result) == 0 {
+		return nil, nil,
+			fmt.Errorf("sheet ( %s ) not meets the request, rows ( %d ), cols ( %d )", sheetName, rowCount, len(header))
 	}
 
-	isPass, pField := gameDB.checkAllFieldFoundColumn(objT, colRecords)
-	if !isPass {
-		if pField != nil {
-			return nil, fmt.Errorf("sheet ( %s ) not found column : %s\n, update excels and try again", sheet.Name, pField.Name)
+	return result, refs, nil
+}
+
+// 将一行数据解析为obj
+// 不带时区的日期按loc解析
+func (gameDB *GameDB) decodeRow(sheetName string, i int, row []string, objT reflect.Type, colInfos columnInfos, maxCol int, startCol int, loc *time.Location) (interface{}, error) {
+	// 自增列(e.g : Id列)不能为空
+	if _, ok := colInfos[startCol-1]; ok {
+		if startCol-1 >= len(row) || len(strings.TrimSpace(row[startCol-1])) == 0 {
+			return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) autoincrease column should not empty", sheetName, i, startCol-1)
 		}
 	}
 
-	for i, row := range sheet.Rows {
-		if i < startRow { // 真正的数据在colName(title)下一行
+	// 利用反射创建obj对象,每行数据都需要一个obj,否则数据会覆盖
+	objStruct := reflect.New(objT.Elem())
+
+	// 多列slice字段有数据的元素数量(field下标 -> 数量)
+	groupLens := make(map[int]int)
+
+	// 最大列后,可能存在诸多注释列不需要解析.
+	// 行尾缺少的单元格按空值处理,保证自定义类型也会Decode.
+	for j := startCol - 1; j <= maxCol; j++ {
+		fieldInfo, ok := colInfos[j]
+		if !ok {
 			continue
 		}
 
-		if nil == row || len(row.Cells) == 0 { // 表格不允许有空行.
-			return nil, fmt.Errorf("empty row : sheet ( %s ) empty row at %d row", sheet.Name, i+1)
+		cellString := ""
+		if j < len(row) {
+			cellString = strings.TrimSpace(row[j])
 		}
 
-		// 利用反射创建obj对象,每行数据都需要一个obj,否则数据会覆盖
-		objStruct := reflect.New(objT.Elem())
+		// 获取结构体某个Field
+		fieldV := objStruct.Elem().Field(fieldInfo.idx)
 
-		for j, cell := range row.Cells {
-			if j < startCol-1 {
-				continue
-			}
+		// struct field 是否 addressable(可取地址的) 和 exported(可导出的:用大小写区分)
+		if !fieldV.CanSet() {
+			return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) can not set to field( %s )",
+				sheetName, i, j, objT.Elem().Field(fieldInfo.idx).Name)
+		}
 
-			if j > maxCol {
-				break // 最大列后,可能存在诸多注释列不需要解析.
+		// 多列字段: 解析到对应的元素或结构体field
+		if len(fieldInfo.group) > 0 {
+			target, seps := groupTarget(fieldV, fieldInfo)
+			if err := decodeValue(target, cellString, seps, loc); err != nil {
+				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) group %s decode err : %s", sheetName, i, j, fieldInfo.group, err.Error())
 			}
+			if fieldV.Kind() == reflect.Slice {
+				n := groupLens[fieldInfo.idx]
+				if len(cellString) > 0 && fieldInfo.elem+1 > n {
+					n = fieldInfo.elem + 1
+				}
+				groupLens[fieldInfo.idx] = n
+			}
+			continue
+		}
 
-			if _, ok := colInfos[j]; !ok {
-				continue
+		// 自定义类型解析
+		// .(Decoder)类型断言,判断类型(*type)是否实现了Decoder接口
+		// 即使无数据,也需要在Decode()中为自定义fieldV分配内存,使其拥有零值,否则具体逻辑使用时需要nil判断,极易出错.
+		if decoder, ok := fieldV.Addr().Interface().(locationDecoder); ok {
+			if err := decoder.decodeIn(cellString, loc); err != nil {
+				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) decode err : %s", sheetName, i, j, err.Error())
 			}
-			fieldInfo := colInfos[j]
-			cellString, err := cell.FormattedValue()
-			if err != nil {
-				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) fomatted err : %s", sheet.Name, i, j, err.Error())
+			continue
+		}
+		if decoder, ok := fieldV.Addr().Interface().(Decoder); ok {
+			if err := decoder.Decode(cellString); err != nil {
+				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) decode err : %s", sheetName, i, j, err.Error())
 			}
-			cellString = strings.TrimSpace(cellString)
+			continue
+		}
 
-			// 自增列(e.g : Id列)不能为空
-			if j == startCol-1 && i >= startRow && (nil == cell || len(cellString) == 0) {
-				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) autoincrease column should not empty", sheet.Name, i, j)
+		// 复合类型按sep tag的分隔符解析(无数据时同样分配空slice,map和指针)
+		if seps := fieldInfo.field.Tag.Get("sep"); len(seps) > 0 {
+			if err := decodeValue(fieldV, cellString, seps, loc); err != nil {
+				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) decode err : %s", sheetName, i, j, err.Error())
 			}
+			continue
+		}
 
-			// 获取结构体某个Field
-			fieldV := objStruct.Elem().Field(fieldInfo.idx)
+		// 基础类型解析
+		// 无数据不解析,使用默认零值
+		if len(cellString) == 0 {
+			continue
+		}
 
-			// struct field 是否 addressable(可取地址的) 和 exported(可导出的:用大小写区分)
-			if !fieldV.CanSet() {
-				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) can not set to field( %s )",
-					sheet.Name, i, j, objT.Elem().Field(fieldInfo.idx).Name)
+		// 日期和时长(time.Duration的Kind为Int64,需要先于基础类型判断)
+		switch fieldV.Type() {
+		case timeType:
+			cellTime, err := parseCellTime(cellString, loc)
+			if err != nil {
+				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) ParseTime err : %s", sheetName, i, j, err.Error())
 			}
-
-			// 自定义类型解析
-			// .(Decoder)类型断言,判断类型(*type)是否实现了Decoder接口
-			// 即使无数据,也需要在Decode()中为自定义fieldV分配内存,使其拥有零值,否则具体逻辑使用时需要nil判断,极易出错.
-			if decoder, ok := fieldV.Addr().Interface().(Decoder); ok {
-				if err := decoder.Decode(cellString); err != nil {
-					return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) decode err : %s", sheet.Name, i, j, err.Error())
-				}
-				continue
+			fieldV.Set(reflect.ValueOf(cellTime))
+			continue
+		case durationType:
+			cellDuration, err := parseCellDuration(cellString)
+			if err != nil {
+				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) ParseDuration err : %s", sheetName, i, j, err.Error())
 			}
+			fieldV.SetInt(int64(cellDuration))
+			continue
+		}
 
-			// 基础类型解析
-			// 无数据不解析,使用默认零值
-			if len(cellString) == 0 {
-				continue
-			}
+		if fieldV.Kind() == reflect.String {
+			str := regexp.MustCompile("\n").ReplaceAllString(cellString, "")
+			fieldV.SetString(strings.Replace(str, `"`, `\"`, -1))
+			continue
+		}
 
-			switch objT.Elem().Field(fieldInfo.idx).Type.Kind() {
-			case reflect.Bool:
-				cellBool, err := strconv.ParseBool(cellString)
-				if err != nil {
-					return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) ParseBool err : %s", sheet.Name, i, j, err.Error())
-				}
-				fieldV.SetBool(cellBool)
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				cellFloat, err := strconv.ParseFloat(cellString, 64)
-				if err != nil {
-					return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) ParseFloat for Int err : %s", sheet.Name, i, j, err.Error())
-				}
-				fieldV.SetInt(int64(util.RoundFloat(cellFloat, 0)))
-			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				cellUint, err := strconv.ParseUint(cellString, 10, 64)
-				if err != nil {
-					return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) ParseUint err : %s", sheet.Name, i, j, err.Error())
-				}
-				fieldV.SetUint(cellUint)
-			case reflect.Float32, reflect.Float64:
-				cellFloat, err := strconv.ParseFloat(cellString, 64)
-				if err != nil {
-					return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) ParseFloat err : %s", sheet.Name, i, j, err.Error())
-				}
-				fieldV.SetFloat(cellFloat)
-			case reflect.String:
-				str := regexp.MustCompile("\n").ReplaceAllString(cellString, "")
-				fieldV.SetString(strings.Replace(str, `"`, `\"`, -1))
-			default:
-				return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) field type error", sheet.Name, i, j)
-			}
+		if err := decodeBasic(fieldV, cellString); err != nil {
+			return nil, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) %s", sheetName, i, j, err.Error())
 		}
+	}
 
-		result = append(result, objStruct.Interface()) // 需要转换为interface类型
+	// 去除末尾没有数据的元素
+	for idx, n := range groupLens {
+		fieldV := objStruct.Elem().Field(idx)
+		fieldV.Set(fieldV.Slice(0, n))
 	}
 
-	return result, nil
+	return objStruct.Interface(), nil // 需要转换为interface类型
 }
 
 // sheet colName为集合A, struct field为集合B (A应>=B)
-func (gameDB *GameDB) collectColumnInfo(sheet *xlsx.Sheet, objT reflect.Type, startRow int, startCol int) (columnInfos, columnRecords, int) {
+func (gameDB *GameDB) collectColumnInfo(header []string, objT reflect.Type, startCol int) (columnInfos, columnRecords, int) {
 	var maxCol int = 0
 	infos := make(columnInfos)
 	records := make(columnRecords)
 
-	for idx, cell := range sheet.Rows[startRow-1].Cells {
+	for idx, cell := range header {
 		if idx < startCol-1 {
 			continue
 		}
 
-		if cell == nil {
-			break
-		}
-
-		cellString := strings.TrimSpace(cell.Value)
+		cellString := strings.TrimSpace(cell)
 
 		if len(cellString) == 0 {
 			break
@@ -561,6 +731,23 @@ func (gameDB *GameDB) collectColumnInfo(sheet *xlsx.Sheet, objT reflect.Type, st
 		// objs struct field
 		for i := 0; i < objT.Elem().NumField(); i++ {
 			field := objT.Elem().Field(i)
+
+			// 多列字段
+			if group := field.Tag.Get("group"); len(group) > 0 && len(field.Tag.Get("col")) == 0 {
+				if elem, sub, ok := matchGroup(field, cellString); ok {
+					infos[idx] = &fieldInfo{
+						idx:     i,
+						field:   &field,
+						group:   group,
+						elem:    elem,
+						sub:     sub,
+						colName: cellString,
+					}
+					records[groupRecord(group)] = true
+				}
+				continue
+			}
+
 			if len(field.Tag.Get("col")) == 0 { //struct的field没有tag(col),即该字段不需解析sheet
 				continue
 			}
@@ -569,7 +756,8 @@ func (gameDB *GameDB) collectColumnInfo(sheet *xlsx.Sheet, objT reflect.Type, st
 				infos[idx] = &fieldInfo{
 					idx:     i,
 					field:   &field,
-					group:   field.Tag.Get("group"), // 组名(暂时用不到)
+					elem:    -1,
+					sub:     -1,
 					colName: cellString,
 				}
 				records[cellString] = true
@@ -581,11 +769,19 @@ func (gameDB *GameDB) collectColumnInfo(sheet *xlsx.Sheet, objT reflect.Type, st
 	return infos, records, maxCol
 }
 
+// 多列字段在columnRecords中的key
+func groupRecord(group string) string {
+	return "group:" + group
+}
+
 // 检查所有的field在sheet中均有对应的column
 func (gameDB *GameDB) checkAllFieldFoundColumn(objT reflect.Type, records columnRecords) (bool, *reflect.StructField) {
 	for i := 0; i < objT.Elem().NumField(); i++ {
 		field := objT.Elem().Field(i)
 		col := field.Tag.Get("col")
+		if group := field.Tag.Get("group"); len(group) > 0 && len(col) == 0 {
+			col = groupRecord(group) // 多列字段至少需要一列
+		}
 		if len(col) == 0 {
 			continue
 		}
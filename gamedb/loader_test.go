@@ -0,0 +1,324 @@
+package gamedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, args ...interface{}) {}
+
+// 配置目录: excels/otherData.csv和空的敏感词库
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "excels"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "filtertext.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeOtherData(t, dir, data, time.Now())
+	return dir
+}
+
+func writeOtherData(t *testing.T, dir string, data string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, "excels", "otherData.csv")
+	content := ",ID,数据\n,,\n,id,data\n,1," + data + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestLoader(dir string, cache CachePolicy) *Loader {
+	registry := &Registry{}
+	registry.register("otherData.csv", arraySheet("otherData", &OtherData{}, "OtherDatas"))
+	return NewLoader(LoaderOptions{
+		Paths:    LoadPaths{Base: dir},
+		Registry: registry,
+		Cache:    cache,
+		Logger:   nopLogger{},
+	})
+}
+
+func loadOtherData(t *testing.T, loader *Loader) string {
+	t.Helper()
+	gameDB, err := loader.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gameDB.OtherDatas) != 1 {
+		t.Fatalf("OtherDatas = %d rows, want 1", len(gameDB.OtherDatas))
+	}
+	return gameDB.OtherDatas[0].Data
+}
+
+func TestLoaderReloadsModifiedExcel(t *testing.T) {
+	for _, cache := range []CachePolicy{CacheReadWrite, CacheReadOnly, CacheOff} {
+		dir := writeTestConfig(t, "a")
+		loader := newTestLoader(dir, cache)
+		if data := loadOtherData(t, loader); data != "a" {
+			t.Fatalf("cache %d : first load got %q, want a", cache, data)
+		}
+
+		writeOtherData(t, dir, "b", time.Now().Add(time.Hour))
+		if data := loadOtherData(t, loader); data != "b" {
+			t.Fatalf("cache %d : second load got %q, want b", cache, data)
+		}
+		if data := loadOtherData(t, loader); data != "b" {
+			t.Fatalf("cache %d : third load got %q, want b", cache, data)
+		}
+
+		_, err := os.Stat(filepath.Join(dir, "gamedb.dat"))
+		if (cache == CacheReadWrite) != (nil == err) {
+			t.Fatalf("cache %d : gamedb.dat exists = %v", cache, nil == err)
+		}
+	}
+}
+
+// 只读模式下.dat是其他进程写入的旧数据, 不能跳过表格
+func TestLoaderReadOnlyIgnoresStaleDat(t *testing.T) {
+	dir := writeTestConfig(t, "old")
+	if data := loadOtherData(t, newTestLoader(dir, CacheReadWrite)); data != "old" {
+		t.Fatalf("got %q, want old", data)
+	}
+
+	writeOtherData(t, dir, "new", time.Now().Add(time.Hour))
+	loader := newTestLoader(dir, CacheReadOnly)
+	for i := 0; i < 2; i++ {
+		if data := loadOtherData(t, loader); data != "new" {
+			t.Fatalf("load %d got %q, want new", i, data)
+		}
+	}
+}
+
+// 其他Loader覆盖了.dat后, 本Loader记录的修改时间失效
+func TestLoaderIgnoresDatWrittenByOthers(t *testing.T) {
+	dir := writeTestConfig(t, "a")
+	loader := newTestLoader(dir, CacheReadWrite)
+	loadOtherData(t, loader)
+
+	writeOtherData(t, dir, "b", time.Now().Add(time.Hour))
+	loadOtherData(t, newTestLoader(dir, CacheReadWrite))
+
+	// 表格恢复为loader记录的修改时间, 但.dat中是b
+	writeOtherData(t, dir, "a", time.Now().Add(2*time.Hour))
+	if data := loadOtherData(t, newTestLoader(dir, CacheReadWrite)); data != "a" {
+		t.Fatalf("got %q, want a", data)
+	}
+	datTime := time.Now().Add(3 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "gamedb.dat"), datTime, datTime); err != nil {
+		t.Fatal(err)
+	}
+	if data := loadOtherData(t, loader); data != "a" {
+		t.Fatalf("got %q, want a", data)
+	}
+}
+
+func TestLoaderReturnsDatWriteError(t *testing.T) {
+	dir := writeTestConfig(t, "a")
+	loader := newTestLoader(dir, CacheReadWrite)
+	loader.opts.Paths.Dat = filepath.Join(dir, "missing", "gamedb.dat")
+	if _, err := loader.Load(context.Background()); nil == err {
+		t.Fatal("Load should fail when gamedb.dat can not be written")
+	}
+	if len(loader.modTimes) != 0 {
+		t.Fatalf("modTimes recorded without .dat : %v", loader.modTimes)
+	}
+}
+
+func TestLoadContextSetsDefaultGameDB(t *testing.T) {
+	dir := writeTestConfig(t, "a")
+	datPath := filepath.Join(dir, "gamedb.dat")
+	if err := newGameDB(nopLogger{}).createFile(datPath); err != nil {
+		t.Fatal(err)
+	}
+	defer setDefaultGameDB(nil)
+
+	if _, err := LoadSceneMapById(1); nil == err {
+		t.Fatal("LoadSceneMapById should fail before Load")
+	}
+	gameDB, err := LoadContext(context.Background(), datPath, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getDefaultGameDB() != gameDB {
+		t.Fatal("LoadContext did not set the default GameDB")
+	}
+	if _, err := LoadSceneMapById(1); err != nil {
+		t.Fatalf("LoadSceneMapById after LoadContext : %v", err)
+	}
+}
+
+func TestDefaultLoadOptions(t *testing.T) {
+	defer SetExcelWorkers(0)
+	defer SetSceneOptions(SceneOptions{})
+	SetExcelWorkers(3)
+	SetSceneOptions(SceneOptions{Lazy: true, MaxParallel: 2})
+	if opts := DefaultLoadOptions(); opts.ExcelWorkers != 3 || opts.Scene != (SceneOptions{Lazy: true, MaxParallel: 2}) {
+		t.Fatalf("DefaultLoadOptions() = %+v", opts)
+	}
+}
+
+// 等待返回后仍在退出中的goroutine, 超时后数量仍多于before时失败
+func checkGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, %d before\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 解析单元格时取消加载
+type testCancelCell struct{}
+
+var testCancelLoad context.CancelFunc
+
+func (cell *testCancelCell) Decode(str string) error {
+	testCancelLoad()
+	return nil
+}
+
+type testCancelRow struct {
+	Id   int            `col:"id"`
+	Data testCancelCell `col:"data"`
+}
+
+// 表格并发加载中途取消, 返回ctx.Err()且加载goroutine全部退出
+func TestLoaderCancelExcels(t *testing.T) {
+	dir := writeTestConfig(t, "a")
+	registry := &Registry{}
+	loaded := 0
+	for i := 0; i < 16; i++ {
+		name := fmt.Sprintf("sheet%d.csv", i)
+		content := ",ID,数据\n,,\n,id,data\n,1,a\n,2,b\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "excels", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		registry.register(name, sheetInfo{sheetName: "sheet", obj: &testCancelRow{}, loader: func(*GameDB, []interface{}) error {
+			loaded++
+			return nil
+		}})
+	}
+	loader := NewLoader(LoaderOptions{Paths: LoadPaths{Base: dir}, Registry: registry, Cache: CacheOff, Workers: 2, Logger: nopLogger{}})
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	testCancelLoad = cancel
+	defer func() { testCancelLoad = nil }()
+
+	gameDB, err := loader.Load(ctx)
+	if !errors.Is(err, context.Canceled) || gameDB != nil {
+		t.Fatalf("canceled Load returned %v, %v", gameDB, err)
+	}
+	if loaded > 0 {
+		t.Fatalf("%d loaders ran after cancel", loaded)
+	}
+	checkGoroutines(t, before)
+}
+
+// 每个sheet解析到该单元格时等待其他sheet, 所有sheet都开始解析后才继续; 串行加载时超时失败
+type testBarrierCell struct{}
+
+var testSheetsStarted sync.WaitGroup
+
+func (cell *testBarrierCell) Decode(str string) error {
+	testSheetsStarted.Done()
+	started := make(chan struct{})
+	go func() {
+		testSheetsStarted.Wait()
+		close(started)
+	}()
+	select {
+	case <-started:
+		return nil
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("sheets not loaded concurrently")
+	}
+}
+
+type testBarrierRow struct {
+	Id   int             `col:"id"`
+	Data testBarrierCell `col:"data"`
+}
+
+// 多个sheet出错时所有错误都返回, sheet并发解析, loader按注册顺序串行执行
+func TestLoaderCollectsErrors(t *testing.T) {
+	dir := writeTestConfig(t, "a")
+	const good = ",ID,数据\n,,\n,id,data\n,1,a\n"
+	const bad = ",ID,数据\n,,\n,id,data\n,x,a\n"
+	const broken = ",\"ID\n" // 无法打开
+	sheets := []struct {
+		content   string
+		loaderErr bool
+	}{{good, false}, {bad, false}, {broken, false}, {good, true}, {good, false}, {bad, false}}
+
+	registry := &Registry{}
+	var order []string
+	testSheetsStarted.Add(3) // 能解析到data列的sheet: 0, 3, 4
+	for i, sheet := range sheets {
+		name := fmt.Sprintf("sheet%d.csv", i)
+		if err := ioutil.WriteFile(filepath.Join(dir, "excels", name), []byte(sheet.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loaderErr := sheet.loaderErr
+		registry.register(name, sheetInfo{sheetName: "sheet", obj: &testBarrierRow{}, loader: func(gameDB *GameDB, objs []interface{}) error {
+			order = append(order, name)
+			if loaderErr {
+				return fmt.Errorf("loader failed")
+			}
+			return nil
+		}})
+	}
+	loader := NewLoader(LoaderOptions{Paths: LoadPaths{Base: dir}, Registry: registry, Cache: CacheOff, Workers: 4, Logger: nopLogger{}})
+
+	_, err := loader.Load(context.Background())
+	var errs LoadErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Load returned %v, want LoadErrors", err)
+	}
+	// 打开文件的错误在前, 之后按注册顺序
+	want := []string{"sheet2.csv has error", "sheet1.csv sheet ( sheet ) has error", "sheet3.csv sheet ( sheet ) has error : loader failed", "sheet5.csv sheet ( sheet ) has error"}
+	if len(errs) != len(want) {
+		t.Fatalf("%d errors, want %d : %v", len(errs), len(want), err)
+	}
+	for i := range want {
+		if !strings.Contains(errs[i].Error(), want[i]) {
+			t.Errorf("error %d = %v, want %q", i, errs[i], want[i])
+		}
+	}
+	if got := fmt.Sprint(order); got != "[sheet0.csv sheet3.csv sheet4.csv]" {
+		t.Fatalf("loaders ran in order %s", got)
+	}
+}
+
+// 解析内存中的sheet(第3行为标题行,第2列开始)
+func readTestSheet(obj interface{}, rows [][]string) ([]interface{}, error) {
+	return readTestSheetIn(obj, rows, time.UTC)
+}
+
+func readTestSheetIn(obj interface{}, rows [][]string, loc *time.Location) ([]interface{}, error) {
+	table := &sheetTable{name: "test", rows: rows}
+	reader := &tableReader{ctx: context.Background(), table: table}
+	objs, _, err := newGameDB(nopLogger{}).readSheet("test", reader, obj, defaultStartRow, defaultStartCol, loc)
+	return objs, err
+}
@@ -0,0 +1,325 @@
+package gamedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tealeg/xlsx"
+)
+
+// 表格文本镜像: 每个注册的xlsx sheet导出为一个csv文件(<文件名>.<sheet名>.csv),
+// 标题行原样保留, map sheet的数据行按key列排序(slice sheet的行顺序即加载顺序, 保持不变), 去除行尾空单元格.
+// 数据行中对应obj field的单元格按解析后的值重新Encode输出(规范化, e.g : 1.0 -> 1, 日期序列号 -> 2024-01-02 00:00:00),
+// 注释列原样输出. 无法解析的行导出失败(加载时同样会失败).
+// 镜像与xlsx一起提交, 修改表格时可以直接review镜像的文本diff; CI中用CheckMirror检查两者是否一致.
+// csv/tsv表格本身就是文本,不生成镜像.
+
+const mirrorExt = ".csv"
+
+type mirrorSheet struct {
+	excelName string
+	sheetName string
+	obj       interface{} // 解析数据行的结构体
+	key       string      // mapSheet的key field, 其他sheet为空
+}
+
+func (sheet mirrorSheet) fileName() string {
+	return strings.TrimSuffix(sheet.excelName, filepath.Ext(sheet.excelName)) + "." + sheet.sheetName + mirrorExt
+}
+
+// 所有注册的xlsx sheet
+func mirrorSheets() []mirrorSheet {
+	var sheets []mirrorSheet
+	for _, excelInfo := range DefaultRegistry().files {
+		if strings.ToLower(filepath.Ext(excelInfo.excelName)) != ".xlsx" {
+			continue
+		}
+		for _, sheetInfo := range excelInfo.sheetInfos {
+			sheets = append(sheets, mirrorSheet{excelInfo.excelName, sheetInfo.sheetName, sheetInfo.obj, sheetInfo.key})
+		}
+	}
+	return sheets
+}
+
+// 将excelDir下所有注册的sheet导出到mirrorDir, 返回写入的文件
+func ExportMirror(excelDir string, mirrorDir string) ([]string, error) {
+	if err := os.MkdirAll(mirrorDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	err := eachMirror(excelDir, func(sheet mirrorSheet, table *sheetTable) error {
+		path := filepath.Join(mirrorDir, sheet.fileName())
+		b, err := encodeMirror(sheet, table)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+		written = append(written, path)
+		return nil
+	})
+	return written, err
+}
+
+// 检查mirrorDir中的镜像与excelDir中的表格是否一致, 返回不一致(或缺失)的镜像文件
+func CheckMirror(excelDir string, mirrorDir string) ([]string, error) {
+	var stale []string
+	err := eachMirror(excelDir, func(sheet mirrorSheet, table *sheetTable) error {
+		path := filepath.Join(mirrorDir, sheet.fileName())
+		expected, err := encodeMirror(sheet, table)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err != nil || !bytes.Equal(b, expected) {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// 将mirrorDir中的镜像写回excelDir中的xlsx(sheet不存在时创建), 返回修改的xlsx文件.
+// 只覆盖单元格的值,其他sheet和单元格样式保留.
+func ImportMirror(mirrorDir string, excelDir string) ([]string, error) {
+	var updated []string
+	files := make(map[string]*xlsx.File)
+	var order []string
+
+	for _, sheet := range mirrorSheets() {
+		book, err := openCSV(context.Background(), filepath.Join(mirrorDir, sheet.fileName()), ',')
+		if err != nil {
+			return nil, err
+		}
+		table := book.table
+
+		excelPath := filepath.Join(excelDir, sheet.excelName)
+		xlsxFile, ok := files[excelPath]
+		if !ok {
+			if xlsxFile, err = openOrCreateXlsx(excelPath); err != nil {
+				return nil, err
+			}
+			files[excelPath] = xlsxFile
+			order = append(order, excelPath)
+		}
+
+		xlsxSheet, ok := xlsxFile.Sheet[sheet.sheetName]
+		if !ok {
+			if xlsxSheet, err = xlsxFile.AddSheet(sheet.sheetName); err != nil {
+				return nil, err
+			}
+		}
+		writeSheetTable(xlsxSheet, table)
+	}
+
+	for _, excelPath := range order {
+		if err := files[excelPath].Save(excelPath); err != nil {
+			return updated, err
+		}
+		updated = append(updated, excelPath)
+	}
+	return updated, nil
+}
+
+func eachMirror(excelDir string, fn func(mirrorSheet, *sheetTable) error) error {
+	books := make(map[string]workbook)
+	defer func() {
+		for _, book := range books {
+			book.close()
+		}
+	}()
+
+	for _, sheet := range mirrorSheets() {
+		book, ok := books[sheet.excelName]
+		if !ok {
+			var err error
+			if book, err = openWorkbook(context.Background(), filepath.Join(excelDir, sheet.excelName)); err != nil {
+				return err
+			}
+			books[sheet.excelName] = book
+		}
+
+		rows, err := book.rows(sheet.sheetName)
+		if err != nil {
+			return fmt.Errorf("%s : %w", sheet.excelName, err)
+		}
+		table, err := readTable(sheet.sheetName, rows)
+		if err != nil {
+			return fmt.Errorf("%s : %w", sheet.excelName, err)
+		}
+		if err := fn(sheet, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 标题行原样输出, 数据行规范化后按key列排序(只排序map sheet)
+func encodeMirror(sheet mirrorSheet, table *sheetTable) ([]byte, error) {
+	rows := make([][]string, 0, len(table.rows))
+	for _, row := range table.rows {
+		rows = append(rows, trimRow(row))
+	}
+	if err := normalizeRows(sheet, rows); err != nil {
+		return nil, fmt.Errorf("%s sheet ( %s ) : %w", sheet.excelName, sheet.sheetName, err)
+	}
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+
+	if len(rows) > defaultStartRow {
+		if keyCol := sheet.keyColumn(rows[defaultStartRow-1]); keyCol >= 0 {
+			data := rows[defaultStartRow:]
+			sort.SliceStable(data, func(i, j int) bool {
+				return lessKey(cellAt(data[i], keyCol), cellAt(data[j], keyCol))
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("%s sheet ( %s ) : %w", sheet.excelName, sheet.sheetName, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// map sheet的key列下标, 不是map sheet或标题行中没有key列时返回-1
+func (sheet mirrorSheet) keyColumn(title []string) int {
+	if len(sheet.key) == 0 {
+		return -1
+	}
+	colInfos, _, _ := newGameDB(stdLogger{}).collectColumnInfo(title, reflect.TypeOf(sheet.obj), defaultStartCol)
+	for j, info := range colInfos {
+		if info.field.Name == sheet.key && info.elem < 0 && info.sub < 0 {
+			return j
+		}
+	}
+	return -1
+}
+
+// 数据行解析为obj后, 将对应field的单元格替换为Encode的结果
+func normalizeRows(sheet mirrorSheet, rows [][]string) error {
+	if len(rows) <= defaultStartRow {
+		return nil
+	}
+
+	gameDB := newGameDB(stdLogger{})
+	objT := reflect.TypeOf(sheet.obj)
+	colInfos, _, maxCol := gameDB.collectColumnInfo(rows[defaultStartRow-1], objT, defaultStartCol)
+
+	for i := defaultStartRow; i < len(rows); i++ {
+		if len(rows[i]) == 0 {
+			continue
+		}
+		obj, err := gameDB.decodeRow(sheet.sheetName, i, rows[i], objT, colInfos, maxCol, defaultStartCol, time.Local)
+		if err != nil {
+			return err
+		}
+
+		objV := reflect.ValueOf(obj).Elem()
+		for j, info := range colInfos {
+			cell, err := encodeColumn(objV, info, time.Local)
+			if err != nil {
+				return fmt.Errorf("row %d column %s : %w", i, info.colName, err)
+			}
+			for len(rows[i]) <= j {
+				rows[i] = append(rows[i], "")
+			}
+			rows[i][j] = cell
+		}
+		rows[i] = trimRow(rows[i])
+	}
+	return nil
+}
+
+// 去除单元格首尾空白和行尾空单元格
+func trimRow(row []string) []string {
+	trimmed := make([]string, len(row))
+	last := 0
+	for i, cell := range row {
+		trimmed[i] = strings.TrimSpace(cell)
+		if len(trimmed[i]) > 0 {
+			last = i + 1
+		}
+	}
+	return trimmed[:last]
+}
+
+func cellAt(row []string, col int) string {
+	if col < len(row) {
+		return row[col]
+	}
+	return ""
+}
+
+// 数字按数值比较,否则按字符串比较
+func lessKey(a, b string) bool {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return fa < fb
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	}
+	return a < b
+}
+
+func openOrCreateXlsx(path string) (*xlsx.File, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return xlsx.NewFile(), nil
+	}
+	return xlsx.OpenFile(path)
+}
+
+// 用table覆盖sheet的单元格值,多余的行和单元格删除
+func writeSheetTable(sheet *xlsx.Sheet, table *sheetTable) {
+	for i, record := range table.rows {
+		for len(sheet.Rows) <= i {
+			sheet.AddRow()
+		}
+		row := sheet.Rows[i]
+		if len(row.Cells) > len(record) {
+			row.Cells = row.Cells[:len(record)]
+		}
+		for j, text := range record {
+			setCellText(sheet.Cell(i, j), text)
+		}
+	}
+
+	if len(sheet.Rows) > len(table.rows) {
+		sheet.Rows = sheet.Rows[:len(table.rows)]
+	}
+	sheet.MaxRow = len(sheet.Rows)
+}
+
+// 能无损转换的数字写为数值单元格,其他写为文本
+func setCellText(cell *xlsx.Cell, text string) {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil && strconv.FormatInt(n, 10) == text {
+		cell.SetInt64(n)
+		return
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == text {
+		cell.SetFloat(f)
+		return
+	}
+	cell.SetString(text)
+}
@@ -0,0 +1,210 @@
+package gamedb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// .dat缓存(gob序列化的GameDB)使用方式
+type CachePolicy int
+
+const (
+	CacheReadWrite CachePolicy = iota // 优先加载.dat,表格有修改时重新生成(默认)
+	CacheReadOnly                     // 只读取.dat,不写入(e.g : 多个进程共享配置目录)
+	CacheOff                          // 不读取也不写入,每次都从表格加载
+)
+
+// 加载日志输出,默认输出到标准输出
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+// 配置文件路径, 为空时使用Base下的默认路径.
+// Base为文件时作为.dat加载,不读取表格.
+type LoadPaths struct {
+	Base     string // 配置目录(或.dat文件)
+	Excels   string // 表格目录, 默认<Base>/excels
+	Dat      string // .dat缓存, 默认<Base>/gamedb.dat
+	OnDemand string // 动态数据, 默认<Base>/onDemandData.json
+	Scenes   string // 地图目录, 默认<Base>/scenes
+	Words    string // 敏感词(分类词库目录或单个文件), 默认<Base>/filtertext/, 不存在时<Base>/filtertext.txt
+}
+
+// 填充默认路径, 返回是否从表格加载
+func (paths LoadPaths) resolve() (LoadPaths, bool, error) {
+	f, err := os.Stat(paths.Base)
+	if err != nil {
+		return paths, false, err
+	}
+
+	dir := paths.Base
+	if !f.IsDir() {
+		dir = filepath.Dir(paths.Base)
+		paths.Dat = paths.Base
+	}
+
+	if len(paths.Excels) == 0 {
+		paths.Excels = filepath.Join(dir, "excels")
+	}
+	if len(paths.Dat) == 0 {
+		paths.Dat = filepath.Join(dir, "gamedb.dat")
+	}
+	if len(paths.OnDemand) == 0 {
+		paths.OnDemand = filepath.Join(dir, "onDemandData.json")
+	}
+	if len(paths.Scenes) == 0 {
+		paths.Scenes = filepath.Join(dir, "scenes")
+	}
+	if len(paths.Words) == 0 {
+		paths.Words = filepath.Join(dir, "filtertext")
+		if f, err := os.Stat(paths.Words); err != nil || !f.IsDir() {
+			paths.Words = filepath.Join(dir, "filtertext.txt")
+		}
+	}
+	return paths, f.IsDir(), nil
+}
+
+type LoaderOptions struct {
+	Paths    LoadPaths      // 配置文件路径
+	Registry *Registry      // 加载的表格, nil时为DefaultRegistry()
+	Cache    CachePolicy    // .dat缓存使用方式
+	Workers  int            // 表格并发加载数量, <=0时为GOMAXPROCS
+	Scene    SceneOptions   // 地图加载方式
+	Logger   Logger         // 加载日志, nil时输出到标准输出
+	StartRow int            // Sheet标题行(从1开始), <=0时为3
+	StartCol int            // Sheet起始列(从1开始), <=0时为2
+	Location *time.Location // 服务器时区, 表格中不带时区的日期按此解析, nil时为time.Local
+}
+
+// 配置加载器. 每次Load返回独立的GameDB(包括地图和敏感词库),
+// 多个Loader(e.g : 不同区服,新旧版本的配置)可以在同一进程中共存.
+type Loader struct {
+	opts LoaderOptions
+
+	lock       sync.Mutex  // 同一Loader的Load串行执行
+	modTimes   fileRecords // 已写入.dat的表格修改时间, 未修改的表格从.dat加载
+	datModTime int64       // 本Loader最后写入的.dat的修改时间
+}
+
+func NewLoader(opts LoaderOptions) *Loader {
+	if nil == opts.Registry {
+		opts.Registry = DefaultRegistry()
+	}
+	if nil == opts.Logger {
+		opts.Logger = stdLogger{}
+	}
+	if opts.StartRow <= 0 {
+		opts.StartRow = defaultStartRow
+	}
+	if opts.StartCol <= 0 {
+		opts.StartCol = defaultStartCol
+	}
+	if nil == opts.Location {
+		opts.Location = time.Local
+	}
+	return &Loader{
+		opts:     opts,
+		modTimes: make(fileRecords),
+	}
+}
+
+// 加载配置: ctx取消或超时后尽快返回ctx.Err(), 返回前所有加载goroutine均已退出.
+func (loader *Loader) Load(ctx context.Context) (*GameDB, error) {
+	loader.lock.Lock()
+	defer loader.lock.Unlock()
+
+	paths, fromExcels, err := loader.opts.Paths.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	gameDB := newGameDB(loader.opts.Logger)
+	if fromExcels {
+		err = loader.loadExcel(ctx, gameDB, paths)
+	} else {
+		err = gameDB.loadFile(ctx, paths.Dat)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 动态数据(不以配置文件的形式加入客户端,在游戏运行时客户端动态请求服务器数据,onDemandData.json由jenkins生成)
+	if temp, err := loadOnDemandData(ctx, paths.OnDemand); nil == err {
+		gameDB.OnDemandData = temp
+	} else {
+		gameDB.logf("%s\n", err.Error())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 组装(生成冗余的,但对于某些module方便的数据结构)
+	gameDB.Patch()
+
+	if err := gameDB.Check(); err != nil {
+		return nil, err
+	}
+
+	if err := loadScenes(ctx, gameDB, paths.Scenes, loader.opts.Scene, loader.opts.Cache); err != nil {
+		return nil, err
+	}
+
+	// 加载敏感词或短语
+	if err := loadSensitivePhrases(ctx, gameDB, paths.Words); err != nil {
+		return nil, err
+	}
+
+	gameDB.Report().printTo(loader.opts.Logger)
+	gameDB.logf("加载gameDB成功!\n")
+	return gameDB, nil
+}
+
+// 包级状态只服务于兼容旧接口的包级函数(Load, SetExcelWorkers, SetSceneOptions, DefaultLoadOptions, GetSceneMap, LoadSceneMapById):
+// 旧代码没有持有GameDB或加载选项的地方, 只能保存在包中. Loader和GameDB的方法不读取这些状态,
+// 需要多套配置或不同选项时使用NewLoader并持有返回的GameDB.
+var defaultLock sync.RWMutex
+var defaultOptions LoadOptions // 包级Load使用的选项
+var defaultGameDB *GameDB      // 包级Load/LoadContext加载的GameDB
+
+// 设置包级Load的表格并发加载数量(<=0时为GOMAXPROCS),需在Load之前调用
+func SetExcelWorkers(workers int) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	defaultOptions.ExcelWorkers = workers
+}
+
+// 设置包级Load的地图加载方式,需在Load之前调用
+func SetSceneOptions(opts SceneOptions) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	defaultOptions.Scene = opts
+}
+
+// SetExcelWorkers和SetSceneOptions设置的选项, 供需要超时控制的调用方传给LoadContext
+func DefaultLoadOptions() LoadOptions {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultOptions
+}
+
+func setDefaultGameDB(gameDB *GameDB) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	defaultGameDB = gameDB
+}
+
+func getDefaultGameDB() *GameDB {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultGameDB
+}
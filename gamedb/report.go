@@ -0,0 +1,102 @@
+package gamedb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 加载过程中收集的多个错误
+type LoadErrors []error
+
+func (errs LoadErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d errors :", len(errs))
+	for _, err := range errs {
+		b.WriteString("\n  ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+type ReportLevel int
+
+const (
+	ReportInfo ReportLevel = iota
+	ReportWarn
+	ReportError
+)
+
+func (level ReportLevel) String() string {
+	switch level {
+	case ReportWarn:
+		return "WARN"
+	case ReportError:
+		return "ERROR"
+	}
+	return "INFO"
+}
+
+type ReportEntry struct {
+	Level   ReportLevel
+	Section string // 所属阶段(e.g : scene, excel)
+	Message string
+}
+
+// 加载报告,记录加载过程中的统计和配置问题,供策划查错.
+type LoadReport struct {
+	lock    sync.Mutex
+	entries []ReportEntry
+}
+
+func newLoadReport() *LoadReport {
+	return &LoadReport{}
+}
+
+func (report *LoadReport) Add(level ReportLevel, section string, format string, args ...interface{}) {
+	report.lock.Lock()
+	defer report.lock.Unlock()
+	report.entries = append(report.entries, ReportEntry{
+		Level:   level,
+		Section: section,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (report *LoadReport) Entries() []ReportEntry {
+	report.lock.Lock()
+	defer report.lock.Unlock()
+	return append([]ReportEntry(nil), report.entries...)
+}
+
+// 指定阶段(section为空则全部)的错误
+func (report *LoadReport) Errors(section string) []ReportEntry {
+	var errs []ReportEntry
+	for _, entry := range report.Entries() {
+		if entry.Level == ReportError && (section == "" || entry.Section == section) {
+			errs = append(errs, entry)
+		}
+	}
+	return errs
+}
+
+func (report *LoadReport) Print() {
+	report.printTo(stdLogger{})
+}
+
+func (report *LoadReport) printTo(logger Logger) {
+	for _, entry := range report.Entries() {
+		logger.Printf("[%s][%s] %s\n", entry.Level, entry.Section, entry.Message)
+	}
+}
+
+// 获取加载报告
+func (gameDB *GameDB) Report() *LoadReport {
+	if nil == gameDB.report {
+		gameDB.report = newLoadReport()
+	}
+	return gameDB.report
+}
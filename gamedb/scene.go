@@ -0,0 +1,268 @@
+package gamedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RoadFlags每一位为一个图层, bit0为可行走, 其余位与地图编辑器导出约定一致.
+type RoadFlag uint8
+
+const (
+	FlagWalkable RoadFlag = 1 << iota // 可行走
+	FlagSafeZone                      // 安全区
+	FlagWater                         // 水域
+)
+
+// RoadFlags的key为 x*roadFlagStride + y
+const roadFlagStride = 1000
+
+// 格子坐标(非像素坐标)
+type Point struct {
+	X int
+	Y int
+}
+
+// 4方向偏移(上,右,下,左)
+var dir4 = [4]Point{{0, -1}, {1, 0}, {0, 1}, {-1, 0}}
+
+// 4个对角方向偏移(右上,右下,左下,左上)
+var dirDiagonal = [4]Point{{1, -1}, {1, 1}, {-1, 1}, {-1, -1}}
+
+// 格子是否在地图范围内
+func (sceneMap *SceneMap) InBounds(x, y int) bool {
+	return x >= 0 && y >= 0 && x < sceneMap.Width && y < sceneMap.Height
+}
+
+// 格子是否可行走(超出地图范围视为不可行走)
+func (sceneMap *SceneMap) IsWalkable(x, y int) bool {
+	if !sceneMap.InBounds(x, y) {
+		return false
+	}
+	return sceneMap.flags[y*sceneMap.Width+x]&uint8(FlagWalkable) != 0
+}
+
+// 格子的全部RoadFlags(超出地图范围返回0)
+func (sceneMap *SceneMap) Flags(x, y int) RoadFlag {
+	if !sceneMap.InBounds(x, y) {
+		return 0
+	}
+	return RoadFlag(sceneMap.flags[y*sceneMap.Width+x])
+}
+
+// 格子是否包含flag中的所有位
+func (sceneMap *SceneMap) HasFlag(x, y int, flag RoadFlag) bool {
+	return sceneMap.Flags(x, y)&flag == flag
+}
+
+// 包含flag的格子数量
+func (sceneMap *SceneMap) CountFlag(flag RoadFlag) int {
+	count := 0
+	for _, v := range sceneMap.flags {
+		if RoadFlag(v)&flag == flag {
+			count++
+		}
+	}
+	return count
+}
+
+// 网格占用的内存(字节)
+func (sceneMap *SceneMap) MemSize() int {
+	return len(sceneMap.flags)
+}
+
+// 像素坐标转换为格子坐标
+func (sceneMap *SceneMap) PixelToCell(px, py int) (int, int) {
+	return floorDiv(px, CellWidth), floorDiv(py, CellHeight)
+}
+
+// 格子坐标转换为像素坐标(格子中心点)
+func (sceneMap *SceneMap) CellToPixel(x, y int) (int, int) {
+	return x*CellWidth + CellWidth/2, y*CellHeight + CellHeight/2
+}
+
+// 像素坐标是否在地图范围内
+func (sceneMap *SceneMap) PixelInBounds(px, py int) bool {
+	return sceneMap.InBounds(sceneMap.PixelToCell(px, py))
+}
+
+// 返回(x,y)周围可行走的相邻格子.
+// diagonal为true时包含对角格子,对角格子要求两侧直角格子均可行走(不切角).
+func (sceneMap *SceneMap) Neighbors(x, y int, diagonal bool) []Point {
+	return sceneMap.AppendNeighbors(make([]Point, 0, 8), x, y, diagonal)
+}
+
+// 同Neighbors,结果追加到dst,用于复用内存.
+func (sceneMap *SceneMap) AppendNeighbors(dst []Point, x, y int, diagonal bool) []Point {
+	for _, d := range dir4 {
+		if sceneMap.IsWalkable(x+d.X, y+d.Y) {
+			dst = append(dst, Point{x + d.X, y + d.Y})
+		}
+	}
+
+	if !diagonal {
+		return dst
+	}
+
+	for _, d := range dirDiagonal {
+		if sceneMap.IsWalkable(x+d.X, y+d.Y) && sceneMap.IsWalkable(x+d.X, y) && sceneMap.IsWalkable(x, y+d.Y) {
+			dst = append(dst, Point{x + d.X, y + d.Y})
+		}
+	}
+
+	return dst
+}
+
+// 向下取整的整数除法(负数坐标也落在正确的格子)
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+type roadFlag struct {
+	key  int32
+	flag uint8
+}
+
+// 流式解析地图json,RoadFlags直接写入网格,不生成中间map.
+// 文件中Width/Height为像素,转换为格子数.
+func decodeSceneMap(b []byte) (*SceneMap, error) {
+	sceneMap := &SceneMap{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+
+	var pending []roadFlag // Width/Height出现在RoadFlags之后时暂存
+	var count int
+	var dropped int
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+
+		switch {
+		case strings.EqualFold(key, "Id"):
+			err = decoder.Decode(&sceneMap.Id)
+		case strings.EqualFold(key, "Name"):
+			err = decoder.Decode(&sceneMap.Name)
+		case strings.EqualFold(key, "Width"):
+			err = decoder.Decode(&sceneMap.Width)
+		case strings.EqualFold(key, "Height"):
+			err = decoder.Decode(&sceneMap.Height)
+		case strings.EqualFold(key, "RoadFlags"):
+			err = decodeRoadFlags(decoder, func(k int32, v uint8) {
+				count++
+				if sceneMap.flags == nil && sceneMap.Width > 0 && sceneMap.Height > 0 {
+					sceneMap.initGrid()
+				}
+				if sceneMap.flags == nil {
+					pending = append(pending, roadFlag{k, v})
+				} else if !sceneMap.setRoadFlag(k, v) {
+					dropped++
+				}
+			})
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %s : %w", key, err)
+		}
+	}
+
+	if count < 1 {
+		return nil, fmt.Errorf("config has no roadFlags")
+	}
+
+	if sceneMap.flags == nil {
+		sceneMap.initGrid()
+	}
+	for _, p := range pending {
+		if !sceneMap.setRoadFlag(p.key, p.flag) {
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		fmt.Printf("decodeSceneMap() map %d has %d roadFlags out of range (%d x %d)\n", sceneMap.Id, dropped, sceneMap.Width, sceneMap.Height)
+	}
+
+	return sceneMap, nil
+}
+
+func (sceneMap *SceneMap) initGrid() {
+	sceneMap.Width = int(math.Ceil(float64(sceneMap.Width) / CellWidth))
+	sceneMap.Height = int(math.Ceil(float64(sceneMap.Height) / CellHeight))
+	sceneMap.flags = make([]uint8, sceneMap.Width*sceneMap.Height)
+}
+
+func (sceneMap *SceneMap) setRoadFlag(key int32, flag uint8) bool {
+	x, y := int(key/roadFlagStride), int(key%roadFlagStride)
+	if !sceneMap.InBounds(x, y) {
+		return false
+	}
+	sceneMap.flags[y*sceneMap.Width+x] = flag
+	return true
+}
+
+func decodeRoadFlags(decoder *json.Decoder, set func(int32, uint8)) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, err := strconv.ParseInt(token.(string), 10, 32)
+		if err != nil {
+			return err
+		}
+
+		if token, err = decoder.Token(); err != nil {
+			return err
+		}
+		number, ok := token.(json.Number)
+		if !ok {
+			return fmt.Errorf("roadFlag %d value %v not a number", key, token)
+		}
+		value, err := strconv.ParseInt(string(number), 10, 16)
+		if err != nil {
+			return err
+		}
+
+		set(int32(key), uint8(value))
+	}
+
+	return expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expect %v but got %v", delim, token)
+	}
+	return nil
+}
+
+// 加载单个地图文件(工具使用),sceneId在文件未提供Id时使用
+func LoadSceneMap(scenePath string, sceneId int) (*SceneMap, error) {
+	return loadSceneMap(context.Background(), scenePath, sceneId, CacheReadWrite)
+}
@@ -0,0 +1,214 @@
+package gamedb
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 场景二进制格式(小端):
+// magic(4) | version(2) | json sha256(32) | id(4) | name len(2) | name | width(4) | height(4) | RLE flags
+// RLE flags : 重复次数(uvarint) + flag(1), 直到填满width*height个格子.
+const (
+	sceneBinMagic   = "SMAP"
+	sceneBinVersion = 1
+	sceneBinExt     = ".bin"
+
+	// 格子数上限(每格1字节), 防止损坏的文件头申请过大的内存
+	maxSceneCells = 1 << 26
+)
+
+type sceneHash [sha256.Size]byte
+
+// 二进制缓存对应的json已修改
+var errSceneBinaryStale = errors.New("scene binary is stale")
+
+// map_*.json对应的二进制缓存路径
+func sceneBinPath(jsonPath string) string {
+	return strings.TrimSuffix(jsonPath, ".json") + sceneBinExt
+}
+
+func (sceneMap *SceneMap) writeBinary(w io.Writer, hash sceneHash) error {
+	bw := bufio.NewWriter(w)
+	le := binary.LittleEndian
+
+	bw.WriteString(sceneBinMagic)
+	binary.Write(bw, le, uint16(sceneBinVersion))
+	bw.Write(hash[:])
+	binary.Write(bw, le, int32(sceneMap.Id))
+	binary.Write(bw, le, uint16(len(sceneMap.Name)))
+	bw.WriteString(sceneMap.Name)
+	binary.Write(bw, le, uint32(sceneMap.Width))
+	binary.Write(bw, le, uint32(sceneMap.Height))
+
+	var buf [binary.MaxVarintLen64]byte
+	for i := 0; i < len(sceneMap.flags); {
+		j := i + 1
+		for j < len(sceneMap.flags) && sceneMap.flags[j] == sceneMap.flags[i] {
+			j++
+		}
+		n := binary.PutUvarint(buf[:], uint64(j-i))
+		bw.Write(buf[:n])
+		bw.WriteByte(sceneMap.flags[i])
+		i = j
+	}
+
+	return bw.Flush()
+}
+
+// 读取二进制缓存, 文件中的json hash与want不一致时在读取网格前返回errSceneBinaryStale.
+func readSceneBinary(r io.Reader, want sceneHash) (*SceneMap, error) {
+	var hash sceneHash
+	br := bufio.NewReader(r)
+	le := binary.LittleEndian
+
+	magic := make([]byte, len(sceneBinMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != sceneBinMagic {
+		return nil, fmt.Errorf("invalid scene binary magic %q", magic)
+	}
+
+	var version uint16
+	if err := binary.Read(br, le, &version); err != nil {
+		return nil, err
+	}
+	if version != sceneBinVersion {
+		return nil, fmt.Errorf("unsupported scene binary version %d", version)
+	}
+
+	if _, err := io.ReadFull(br, hash[:]); err != nil {
+		return nil, err
+	}
+	if hash != want {
+		return nil, errSceneBinaryStale
+	}
+
+	var header struct {
+		Id      int32
+		NameLen uint16
+	}
+	if err := binary.Read(br, le, &header); err != nil {
+		return nil, err
+	}
+	name := make([]byte, header.NameLen)
+	if _, err := io.ReadFull(br, name); err != nil {
+		return nil, err
+	}
+
+	var size struct {
+		Width  uint32
+		Height uint32
+	}
+	if err := binary.Read(br, le, &size); err != nil {
+		return nil, err
+	}
+	if size.Width == 0 || size.Height == 0 || uint64(size.Width)*uint64(size.Height) > maxSceneCells {
+		return nil, fmt.Errorf("invalid scene binary size %d x %d", size.Width, size.Height)
+	}
+
+	sceneMap := &SceneMap{
+		Id:     int(header.Id),
+		Name:   string(name),
+		Width:  int(size.Width),
+		Height: int(size.Height),
+		flags:  make([]uint8, int(size.Width)*int(size.Height)),
+	}
+
+	for i := 0; i < len(sceneMap.flags); {
+		run, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		flag, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if run == 0 || uint64(i)+run > uint64(len(sceneMap.flags)) {
+			return nil, fmt.Errorf("scene binary run %d overflows grid at %d", run, i)
+		}
+		for end := i + int(run); i < end; i++ {
+			sceneMap.flags[i] = flag
+		}
+	}
+
+	return sceneMap, nil
+}
+
+// 读取二进制缓存,缓存不存在或与json内容不一致时返回nil.
+func loadSceneBinary(binPath string, hash sceneHash) *SceneMap {
+	f, err := os.Open(binPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	sceneMap, err := readSceneBinary(f, hash)
+	if err != nil {
+		if err != errSceneBinaryStale {
+			fmt.Printf("loadSceneBinary() read %s err : %v\n", binPath, err)
+		}
+		return nil
+	}
+	return sceneMap
+}
+
+func saveSceneBinary(binPath string, sceneMap *SceneMap, hash sceneHash) error {
+	// 先在同目录写临时文件再改名,避免并发加载读到写了一半的文件,并发写入时各自使用不同的临时文件
+	f, err := os.CreateTemp(filepath.Dir(binPath), filepath.Base(binPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	if err := sceneMap.writeBinary(f, hash); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, binPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// 将map_*.json转换为二进制格式(工具使用), binPath为空时写到json同目录.
+func ConvertSceneMap(jsonPath string, binPath string, sceneId int) (*SceneMap, error) {
+	b, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sceneMap, err := decodeSceneMapFile(b, sceneId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(binPath) == 0 {
+		binPath = sceneBinPath(jsonPath)
+	}
+	return sceneMap, saveSceneBinary(binPath, sceneMap, sha256.Sum256(b))
+}
+
+// 二进制文件与json内容是否一致
+func SceneBinaryUpToDate(jsonPath string) (bool, error) {
+	b, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		return false, err
+	}
+	return loadSceneBinary(sceneBinPath(jsonPath), sha256.Sum256(b)) != nil, nil
+}
@@ -0,0 +1,131 @@
+package gamedb
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSceneBinaryRoundTrip(t *testing.T) {
+	sceneMap := randomSceneMap(rand.New(rand.NewSource(1)), 37, 21, 0.3)
+	sceneMap.Id, sceneMap.Name = 7, "scene_7"
+	hash := sceneHash{1, 2, 3}
+
+	var buf bytes.Buffer
+	if err := sceneMap.writeBinary(&buf, hash); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	decoded, err := readSceneBinary(bytes.NewReader(b), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, sceneMap) {
+		t.Fatalf("decoded %+v, want %+v", decoded, sceneMap)
+	}
+
+	if _, err := readSceneBinary(bytes.NewReader(b), sceneHash{}); err != errSceneBinaryStale {
+		t.Fatalf("stale hash : %v", err)
+	}
+	if _, err := readSceneBinary(bytes.NewReader(b[:len(b)-1]), hash); nil == err {
+		t.Fatal("truncated binary should fail")
+	}
+}
+
+// 文件头中的宽高超出上限时不分配网格
+func TestSceneBinaryRejectsHugeSize(t *testing.T) {
+	hash := sceneHash{1}
+	var buf bytes.Buffer
+	if err := (&SceneMap{Id: 1, Width: 1, Height: 1, flags: []uint8{1}}).writeBinary(&buf, hash); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	// magic(4) | version(2) | hash(32) | id(4) | name len(2) | name(0) | width(4) | height(4)
+	sizeAt := 4 + 2 + len(hash) + 4 + 2
+	for _, size := range [][2]uint32{{0xFFFFFFFF, 0xFFFFFFFF}, {maxSceneCells, 2}, {0, 1}} {
+		binary.LittleEndian.PutUint32(b[sizeAt:], size[0])
+		binary.LittleEndian.PutUint32(b[sizeAt+4:], size[1])
+		if _, err := readSceneBinary(bytes.NewReader(b), hash); nil == err {
+			t.Fatalf("size %d x %d should fail", size[0], size[1])
+		}
+	}
+}
+
+// 并发保存同一个文件, 结果完整且不残留临时文件
+func TestSaveSceneBinary(t *testing.T) {
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "map_1.bin")
+	sceneMap := randomSceneMap(rand.New(rand.NewSource(1)), 50, 40, 0.3)
+	hash := sceneHash{9}
+
+	var waiter sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			if err := saveSceneBinary(binPath, sceneMap, hash); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waiter.Wait()
+
+	if loaded := loadSceneBinary(binPath, hash); !reflect.DeepEqual(loaded, sceneMap) {
+		t.Fatalf("loaded %+v, want %+v", loaded, sceneMap)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("files left in %s : %v", dir, entries)
+	}
+}
+
+// 只有CacheReadWrite时在json旁写入二进制缓存, CacheOff时忽略已有的缓存
+func TestLoadSceneMapCachePolicy(t *testing.T) {
+	for _, cache := range []CachePolicy{CacheReadOnly, CacheOff} {
+		jsonPath := fmt.Sprintf(writeTestSceneMaps(t, 1), 1)
+		if _, err := loadSceneMap(context.Background(), jsonPath, 1, cache); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(sceneBinPath(jsonPath)); !os.IsNotExist(err) {
+			t.Fatalf("cache policy %d wrote binary : %v", cache, err)
+		}
+	}
+
+	jsonPath := fmt.Sprintf(writeTestSceneMaps(t, 1), 1)
+	sceneMap, err := loadSceneMap(context.Background(), jsonPath, 1, CacheReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := SceneBinaryUpToDate(jsonPath); !ok || err != nil {
+		t.Fatalf("CacheReadWrite should write binary : %v %v", ok, err)
+	}
+
+	// 缓存内容与json不同, CacheReadOnly读取缓存, CacheOff重新解析json
+	b, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := &SceneMap{Id: 99, Width: 1, Height: 1, flags: []uint8{1}}
+	if err := saveSceneBinary(sceneBinPath(jsonPath), cached, sha256.Sum256(b)); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := loadSceneMap(context.Background(), jsonPath, 1, CacheReadOnly); err != nil || loaded.Id != cached.Id {
+		t.Fatalf("CacheReadOnly loaded %+v, %v; want cached binary", loaded, err)
+	}
+	if loaded, err := loadSceneMap(context.Background(), jsonPath, 1, CacheOff); err != nil || !reflect.DeepEqual(loaded, sceneMap) {
+		t.Fatalf("CacheOff loaded %+v, %v; want json", loaded, err)
+	}
+}
@@ -0,0 +1,203 @@
+package gamedb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+const reportSectionScene = "scene"
+
+// 连通区域格子数不小于该值视为大区域,一张地图存在多个大区域时报告(可能是孤岛)
+var largeComponentCells = 100
+
+// 配置表中引用的场景坐标点(出生点,传送点,NPC等)
+type ScenePoint struct {
+	MapId  int
+	X      int // 格子坐标
+	Y      int
+	Source string // 来源描述(e.g : "Npcs[1001].pos"),用于报告定位
+}
+
+// 配置表行结构实现该接口后,加载场景时会校验其引用的坐标点可行走且位于地图的主区域.
+// e.g : func (npc *Npc) ScenePoints() []ScenePoint { return []ScenePoint{{npc.MapId, npc.X, npc.Y, fmt.Sprintf("Npcs[%d]", npc.Id)}} }
+type ScenePointer interface {
+	ScenePoints() []ScenePoint
+}
+
+// 地图连通区域(4方向连通).
+// 不切角的8方向移动与4方向连通性一致,因此同一区域内的格子一定相互可达.
+type SceneComponents struct {
+	width  int
+	labels []int32 // 每个格子所属区域,不可行走为-1
+	Sizes  []int   // 区域格子数,下标为区域编号
+}
+
+// 标记地图的连通区域
+func (sceneMap *SceneMap) Components() *SceneComponents {
+	components := &SceneComponents{
+		width:  sceneMap.Width,
+		labels: make([]int32, len(sceneMap.flags)),
+	}
+	for i := range components.labels {
+		components.labels[i] = -1
+	}
+
+	queue := make([]int, 0, 64)
+	for start := range sceneMap.flags {
+		if components.labels[start] >= 0 || sceneMap.flags[start]&uint8(FlagWalkable) == 0 {
+			continue
+		}
+
+		label := int32(len(components.Sizes))
+		size := 0
+		components.labels[start] = label
+		queue = append(queue[:0], start)
+		for len(queue) > 0 {
+			idx := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			size++
+
+			x, y := idx%sceneMap.Width, idx/sceneMap.Width
+			for _, d := range dir4 {
+				nx, ny := x+d.X, y+d.Y
+				if !sceneMap.IsWalkable(nx, ny) {
+					continue
+				}
+				next := ny*sceneMap.Width + nx
+				if components.labels[next] < 0 {
+					components.labels[next] = label
+					queue = append(queue, next)
+				}
+			}
+		}
+		components.Sizes = append(components.Sizes, size)
+	}
+
+	return components
+}
+
+// 格子所属区域编号,不可行走或超出范围返回-1
+func (components *SceneComponents) Label(x, y int) int {
+	if x < 0 || y < 0 || x >= components.width || y*components.width+x >= len(components.labels) {
+		return -1
+	}
+	return int(components.labels[y*components.width+x])
+}
+
+// 两个格子是否相互可达
+func (components *SceneComponents) Connected(a, b Point) bool {
+	label := components.Label(a.X, a.Y)
+	return label >= 0 && label == components.Label(b.X, b.Y)
+}
+
+// 格子数不小于minCells的区域编号(按格子数从大到小)
+func (components *SceneComponents) Large(minCells int) []int {
+	var labels []int
+	for label, size := range components.Sizes {
+		if size >= minCells {
+			labels = append(labels, label)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return components.Sizes[labels[i]] > components.Sizes[labels[j]]
+	})
+	return labels
+}
+
+// 格子数最多的区域(地图的主区域), 没有可行走格子时为-1
+func (components *SceneComponents) Main() int {
+	main := -1
+	for label, size := range components.Sizes {
+		if main < 0 || size > components.Sizes[main] {
+			main = label
+		}
+	}
+	return main
+}
+
+// 收集GameDB中所有实现ScenePointer的配置行(注册表格加载的map,slice)引用的坐标点
+func (gameDB *GameDB) scenePoints() map[int][]ScenePoint {
+	points := make(map[int][]ScenePoint)
+	gameDBV := reflect.ValueOf(gameDB).Elem()
+	for i := 0; i < gameDBV.NumField(); i++ {
+		addScenePoints(points, gameDBV.Field(i))
+	}
+	return points
+}
+
+// rows为配置行的map,slice或array
+func addScenePoints(points map[int][]ScenePoint, rows reflect.Value) {
+	add := func(v reflect.Value) {
+		if !v.CanInterface() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+			return
+		}
+		if pointer, ok := v.Interface().(ScenePointer); ok {
+			for _, point := range pointer.ScenePoints() {
+				points[point.MapId] = append(points[point.MapId], point)
+			}
+		}
+	}
+
+	switch rows.Kind() {
+	case reflect.Map:
+		iter := rows.MapRange()
+		for iter.Next() {
+			add(iter.Value())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rows.Len(); i++ {
+			add(rows.Index(i))
+		}
+	}
+}
+
+// 分析地图连通性,校验配置引用的坐标点,结果写入加载报告.
+func (gameDB *GameDB) checkSceneMap(sceneMap *SceneMap, points []ScenePoint) {
+	report := gameDB.Report()
+	components := sceneMap.Components()
+
+	if large := components.Large(largeComponentCells); len(large) > 1 {
+		sizes := make([]int, 0, len(large))
+		for _, label := range large {
+			sizes = append(sizes, components.Sizes[label])
+		}
+		report.Add(ReportWarn, reportSectionScene, "map %d (%s) has %d large walkable regions, cells : %v",
+			sceneMap.Id, sceneMap.Name, len(large), sizes)
+	}
+
+	main := components.Main()
+	for _, point := range points {
+		if !sceneMap.IsWalkable(point.X, point.Y) {
+			report.Add(ReportError, reportSectionScene, "map %d point (%d, %d) from %s not walkable",
+				sceneMap.Id, point.X, point.Y, point.Source)
+			continue
+		}
+		if components.Label(point.X, point.Y) != main {
+			report.Add(ReportError, reportSectionScene, "map %d point (%d, %d) from %s unreachable from the main region (%d cells)",
+				sceneMap.Id, point.X, point.Y, point.Source, components.Sizes[main])
+		}
+	}
+}
+
+// 所有地图分析完成后调用,存在错误时返回汇总
+func (gameDB *GameDB) checkScenes(maps map[int]*SceneMap) error {
+	points := gameDB.scenePoints()
+	for mapId, mapPoints := range points {
+		if _, ok := maps[mapId]; !ok {
+			for _, point := range mapPoints {
+				gameDB.Report().Add(ReportError, reportSectionScene, "point (%d, %d) from %s references unknown map %d",
+					point.X, point.Y, point.Source, mapId)
+			}
+		}
+	}
+
+	for _, sceneMap := range maps {
+		gameDB.checkSceneMap(sceneMap, points[sceneMap.Id])
+	}
+
+	if errs := gameDB.Report().Errors(reportSectionScene); len(errs) > 0 {
+		return fmt.Errorf("scene check failed with %d errors, first : %s", len(errs), errs[0].Message)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package gamedb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSceneComponents(t *testing.T) {
+	sceneMap := newTestSceneMap(
+		"..#...",
+		"..#.#.",
+		"###...",
+		".#....",
+	)
+	components := sceneMap.Components()
+	if len(components.Sizes) != 3 {
+		t.Fatalf("sizes %v, want 3 regions", components.Sizes)
+	}
+
+	tests := []struct {
+		a, b Point
+		want bool
+	}{
+		{Point{0, 0}, Point{1, 1}, true},
+		{Point{3, 0}, Point{2, 3}, true},
+		{Point{5, 1}, Point{3, 3}, true},
+		{Point{0, 0}, Point{3, 0}, false},
+		{Point{0, 3}, Point{2, 3}, false},
+		{Point{2, 0}, Point{2, 0}, false},
+		{Point{-1, 0}, Point{-1, 0}, false},
+	}
+	for _, test := range tests {
+		if got := components.Connected(test.a, test.b); got != test.want {
+			t.Errorf("Connected(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+
+	large := components.Large(4)
+	if len(large) != 2 || components.Sizes[large[0]] != 12 || components.Sizes[large[1]] != 4 {
+		t.Fatalf("Large(4) = %v, sizes %v", large, components.Sizes)
+	}
+}
+
+func TestCheckSceneMapReportsIslands(t *testing.T) {
+	defer func(cells int) { largeComponentCells = cells }(largeComponentCells)
+	largeComponentCells = 4
+
+	gameDB := newGameDB(nopLogger{})
+	gameDB.checkSceneMap(newTestSceneMap(
+		"..#..",
+		"..#..",
+	), nil)
+	gameDB.checkSceneMap(newTestSceneMap(
+		".....",
+		"..#..",
+	), nil)
+
+	entries := gameDB.Report().Entries()
+	if len(entries) != 1 || entries[0].Level != ReportWarn || !strings.Contains(entries[0].Message, "2 large walkable regions") {
+		t.Fatalf("report %+v, want one island warning", entries)
+	}
+}
+
+type testSpawn struct {
+	Id    int
+	MapId int
+	X     int
+	Y     int
+}
+
+func (spawn *testSpawn) ScenePoints() []ScenePoint {
+	return []ScenePoint{{spawn.MapId, spawn.X, spawn.Y, fmt.Sprintf("Spawns[%d]", spawn.Id)}}
+}
+
+func TestCheckScenePoints(t *testing.T) {
+	sceneMap := newTestSceneMap(
+		"....#..",
+		"....#..",
+		"....#..",
+	)
+	sceneMap.Id = 1
+	spawns := map[int]*testSpawn{
+		1: {1, 1, 0, 0}, // 主区域内
+		2: {2, 1, 4, 1}, // 阻挡
+		3: {3, 1, 6, 2}, // 孤岛
+		4: {4, 1, 3, 2},
+		5: nil,
+	}
+	points := make(map[int][]ScenePoint)
+	addScenePoints(points, reflect.ValueOf(spawns))
+	addScenePoints(points, reflect.ValueOf([]*testSpawn{{6, 2, 0, 0}}))
+	if len(points[1]) != 4 || len(points[2]) != 1 {
+		t.Fatalf("points %v", points)
+	}
+
+	gameDB := newGameDB(nopLogger{})
+	gameDB.checkSceneMap(sceneMap, points[1])
+	var errs []string
+	for _, entry := range gameDB.Report().Errors(reportSectionScene) {
+		errs = append(errs, entry.Message)
+	}
+	sort.Strings(errs)
+	want := []string{
+		"map 1 point (4, 1) from Spawns[2] not walkable",
+		"map 1 point (6, 2) from Spawns[3] unreachable from the main region (12 cells)",
+	}
+	if fmt.Sprint(errs) != fmt.Sprint(want) {
+		t.Fatalf("errors %q, want %q", errs, want)
+	}
+}
@@ -0,0 +1,487 @@
+package gamedb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 移动代价(直线10,对角14,约等于10*sqrt(2))
+const (
+	straightCost = 10
+	diagonalCost = 14
+)
+
+var (
+	ErrPointNotWalkable = errors.New("path point not walkable")
+	ErrNoPath           = errors.New("no path found")
+	ErrSearchLimit      = errors.New("path search exceeds node limit")
+)
+
+// 对角移动时对两侧直角格子的要求
+type CornerRule int
+
+const (
+	CornerNever   CornerRule = iota // 两侧直角格子都可行走才能斜走(不切角)
+	CornerOneSide                   // 至少一侧可行走即可斜走
+	CornerAlways                    // 只要目标格子可行走即可斜走
+)
+
+type PathOptions struct {
+	Diagonal  bool       // true:8方向移动, false:4方向移动
+	Corner    CornerRule // 对角移动规则, Diagonal为true时有效
+	JumpPoint bool       // 使用JPS加速, 仅支持8方向+CornerNever, 其他情况自动使用A*
+	MaxNodes  int        // 最多展开的节点数, <=0不限制
+	Smooth    bool       // 视线检测平滑路径, 结果只保留拐点
+}
+
+type openNode struct {
+	idx int32
+	f   int32
+	h   int32
+}
+
+// 最小堆(f相同时h小的优先)
+type openHeap []openNode
+
+func (h openHeap) less(i, j int) bool {
+	if h[i].f != h[j].f {
+		return h[i].f < h[j].f
+	}
+	return h[i].h < h[j].h
+}
+
+func (h *openHeap) push(node openNode) {
+	*h = append(*h, node)
+	heap := *h
+	i := len(heap) - 1
+	for i > 0 {
+		p := (i - 1) / 2
+		if !heap.less(i, p) {
+			break
+		}
+		heap[i], heap[p] = heap[p], heap[i]
+		i = p
+	}
+}
+
+func (h *openHeap) pop() openNode {
+	heap := *h
+	top := heap[0]
+	last := len(heap) - 1
+	heap[0] = heap[last]
+	heap = heap[:last]
+	i := 0
+	for {
+		l, r, small := 2*i+1, 2*i+2, i
+		if l < len(heap) && heap.less(l, small) {
+			small = l
+		}
+		if r < len(heap) && heap.less(r, small) {
+			small = r
+		}
+		if small == i {
+			break
+		}
+		heap[i], heap[small] = heap[small], heap[i]
+		i = small
+	}
+	*h = heap
+	return top
+}
+
+// 寻路器,内部缓存按地图大小分配,多次寻路复用,避免每帧分配内存.
+// 非并发安全,每个goroutine(e.g : 场景tick)持有自己的PathFinder.
+type PathFinder struct {
+	sceneMap *SceneMap
+	opts     PathOptions
+
+	curGen uint32   // 当前搜索批次
+	gen    []uint32 // 格子最近一次被访问的批次,不等于curGen视为未访问
+	closed []uint32 // 格子被关闭的批次
+	gScore []int32
+	parent []int32
+	open   openHeap
+	nbuf   []Point
+	rbuf   []Point
+}
+
+func NewPathFinder(sceneMap *SceneMap, opts PathOptions) *PathFinder {
+	size := sceneMap.Width * sceneMap.Height
+	return &PathFinder{
+		sceneMap: sceneMap,
+		opts:     opts,
+		gen:      make([]uint32, size),
+		closed:   make([]uint32, size),
+		gScore:   make([]int32, size),
+		parent:   make([]int32, size),
+		open:     make(openHeap, 0, 64),
+		nbuf:     make([]Point, 0, 8),
+	}
+}
+
+// 便捷方法,每次调用都会分配寻路缓存,频繁寻路请使用NewPathFinder.
+func (sceneMap *SceneMap) FindPath(start, goal Point, opts PathOptions) ([]Point, error) {
+	return NewPathFinder(sceneMap, opts).FindPath(start, goal, nil)
+}
+
+func (pathFinder *PathFinder) SetOptions(opts PathOptions) {
+	pathFinder.opts = opts
+}
+
+// 寻路,返回包含起点和终点的格子路径(Smooth时只包含拐点).
+// 结果追加到dst[:0],传入上次的结果可复用内存.
+func (pathFinder *PathFinder) FindPath(start, goal Point, dst []Point) ([]Point, error) {
+	sceneMap := pathFinder.sceneMap
+	if !sceneMap.IsWalkable(start.X, start.Y) {
+		return nil, fmt.Errorf("%w : start (%d, %d) in map %d", ErrPointNotWalkable, start.X, start.Y, sceneMap.Id)
+	}
+	if !sceneMap.IsWalkable(goal.X, goal.Y) {
+		return nil, fmt.Errorf("%w : goal (%d, %d) in map %d", ErrPointNotWalkable, goal.X, goal.Y, sceneMap.Id)
+	}
+
+	dst = dst[:0]
+	if start == goal {
+		return append(dst, start), nil
+	}
+
+	pathFinder.nextGen()
+	pathFinder.open = pathFinder.open[:0]
+
+	jump := pathFinder.useJumpPoint()
+	startIdx, goalIdx := pathFinder.index(start.X, start.Y), pathFinder.index(goal.X, goal.Y)
+	pathFinder.visit(startIdx, 0, -1)
+	h := pathFinder.heuristic(start, goal)
+	pathFinder.open.push(openNode{idx: startIdx, f: h, h: h})
+
+	expanded := 0
+	for len(pathFinder.open) > 0 {
+		node := pathFinder.open.pop()
+		if pathFinder.closed[node.idx] == pathFinder.curGen {
+			continue // 堆中的过期节点
+		}
+		pathFinder.closed[node.idx] = pathFinder.curGen
+
+		if node.idx == goalIdx {
+			return pathFinder.buildPath(goalIdx, jump, dst), nil
+		}
+
+		expanded++
+		if pathFinder.opts.MaxNodes > 0 && expanded > pathFinder.opts.MaxNodes {
+			return nil, ErrSearchLimit
+		}
+
+		cur := pathFinder.point(node.idx)
+		if jump {
+			pathFinder.nbuf = pathFinder.jumpNeighbors(pathFinder.nbuf[:0], cur, node.idx)
+		} else {
+			pathFinder.nbuf = pathFinder.neighbors(pathFinder.nbuf[:0], cur)
+		}
+
+		for _, next := range pathFinder.nbuf {
+			if jump {
+				var ok bool
+				if next, ok = pathFinder.jump(next.X, next.Y, next.X-cur.X, next.Y-cur.Y, goal); !ok {
+					continue
+				}
+			}
+
+			nextIdx := pathFinder.index(next.X, next.Y)
+			if pathFinder.closed[nextIdx] == pathFinder.curGen {
+				continue
+			}
+
+			g := pathFinder.gScore[node.idx] + pathFinder.distance(cur, next)
+			if pathFinder.gen[nextIdx] == pathFinder.curGen && g >= pathFinder.gScore[nextIdx] {
+				continue
+			}
+
+			pathFinder.visit(nextIdx, g, node.idx)
+			h := pathFinder.heuristic(next, goal)
+			pathFinder.open.push(openNode{idx: nextIdx, f: g + h, h: h})
+		}
+	}
+
+	return nil, ErrNoPath
+}
+
+func (pathFinder *PathFinder) useJumpPoint() bool {
+	return pathFinder.opts.JumpPoint && pathFinder.opts.Diagonal && pathFinder.opts.Corner == CornerNever
+}
+
+func (pathFinder *PathFinder) nextGen() {
+	pathFinder.curGen++
+	if pathFinder.curGen == 0 { // 溢出后清空批次记录
+		for i := range pathFinder.gen {
+			pathFinder.gen[i] = 0
+			pathFinder.closed[i] = 0
+		}
+		pathFinder.curGen = 1
+	}
+}
+
+func (pathFinder *PathFinder) visit(idx int32, g int32, parent int32) {
+	pathFinder.gen[idx] = pathFinder.curGen
+	pathFinder.gScore[idx] = g
+	pathFinder.parent[idx] = parent
+}
+
+func (pathFinder *PathFinder) index(x, y int) int32 {
+	return int32(y*pathFinder.sceneMap.Width + x)
+}
+
+func (pathFinder *PathFinder) point(idx int32) Point {
+	w := int32(pathFinder.sceneMap.Width)
+	return Point{int(idx % w), int(idx / w)}
+}
+
+// 两点在同一直线或对角线上(或任意两点的估值)的八方向距离
+func (pathFinder *PathFinder) distance(a, b Point) int32 {
+	dx, dy := abs(a.X-b.X), abs(a.Y-b.Y)
+	if dx < dy {
+		dx, dy = dy, dx
+	}
+	return int32(straightCost*(dx-dy) + diagonalCost*dy)
+}
+
+func (pathFinder *PathFinder) heuristic(a, b Point) int32 {
+	if !pathFinder.opts.Diagonal {
+		return int32(straightCost * (abs(a.X-b.X) + abs(a.Y-b.Y)))
+	}
+	return pathFinder.distance(a, b)
+}
+
+func (pathFinder *PathFinder) walkable(x, y int) bool {
+	return pathFinder.sceneMap.IsWalkable(x, y)
+}
+
+// 从(x,y)向(dx,dy)移动一格是否可行(dx,dy取值-1,0,1)
+func (pathFinder *PathFinder) canStep(x, y, dx, dy int) bool {
+	if !pathFinder.walkable(x+dx, y+dy) {
+		return false
+	}
+	if dx == 0 || dy == 0 {
+		return true
+	}
+	if !pathFinder.opts.Diagonal {
+		return false
+	}
+	switch pathFinder.opts.Corner {
+	case CornerAlways:
+		return true
+	case CornerOneSide:
+		return pathFinder.walkable(x+dx, y) || pathFinder.walkable(x, y+dy)
+	default:
+		return pathFinder.walkable(x+dx, y) && pathFinder.walkable(x, y+dy)
+	}
+}
+
+func (pathFinder *PathFinder) neighbors(dst []Point, cur Point) []Point {
+	for _, d := range dir4 {
+		if pathFinder.canStep(cur.X, cur.Y, d.X, d.Y) {
+			dst = append(dst, Point{cur.X + d.X, cur.Y + d.Y})
+		}
+	}
+	if !pathFinder.opts.Diagonal {
+		return dst
+	}
+	for _, d := range dirDiagonal {
+		if pathFinder.canStep(cur.X, cur.Y, d.X, d.Y) {
+			dst = append(dst, Point{cur.X + d.X, cur.Y + d.Y})
+		}
+	}
+	return dst
+}
+
+// JPS邻居剪枝(8方向,不切角)
+func (pathFinder *PathFinder) jumpNeighbors(dst []Point, cur Point, idx int32) []Point {
+	parentIdx := pathFinder.parent[idx]
+	if parentIdx < 0 {
+		return pathFinder.neighbors(dst, cur)
+	}
+
+	parent := pathFinder.point(parentIdx)
+	dx, dy := sign(cur.X-parent.X), sign(cur.Y-parent.Y)
+	x, y := cur.X, cur.Y
+
+	switch {
+	case dx != 0 && dy != 0:
+		walkY, walkX := pathFinder.walkable(x, y+dy), pathFinder.walkable(x+dx, y)
+		if walkY {
+			dst = append(dst, Point{x, y + dy})
+		}
+		if walkX {
+			dst = append(dst, Point{x + dx, y})
+		}
+		if walkY && walkX && pathFinder.walkable(x+dx, y+dy) {
+			dst = append(dst, Point{x + dx, y + dy})
+		}
+	case dx != 0:
+		next, up, down := pathFinder.walkable(x+dx, y), pathFinder.walkable(x, y-1), pathFinder.walkable(x, y+1)
+		if next {
+			dst = append(dst, Point{x + dx, y})
+			if up && pathFinder.walkable(x+dx, y-1) {
+				dst = append(dst, Point{x + dx, y - 1})
+			}
+			if down && pathFinder.walkable(x+dx, y+1) {
+				dst = append(dst, Point{x + dx, y + 1})
+			}
+		}
+		if up {
+			dst = append(dst, Point{x, y - 1})
+		}
+		if down {
+			dst = append(dst, Point{x, y + 1})
+		}
+	default:
+		next, left, right := pathFinder.walkable(x, y+dy), pathFinder.walkable(x-1, y), pathFinder.walkable(x+1, y)
+		if next {
+			dst = append(dst, Point{x, y + dy})
+			if left && pathFinder.walkable(x-1, y+dy) {
+				dst = append(dst, Point{x - 1, y + dy})
+			}
+			if right && pathFinder.walkable(x+1, y+dy) {
+				dst = append(dst, Point{x + 1, y + dy})
+			}
+		}
+		if left {
+			dst = append(dst, Point{x - 1, y})
+		}
+		if right {
+			dst = append(dst, Point{x + 1, y})
+		}
+	}
+
+	return dst
+}
+
+// 从(x,y)沿(dx,dy)方向跳跃,返回找到的跳点
+func (pathFinder *PathFinder) jump(x, y, dx, dy int, goal Point) (Point, bool) {
+	for {
+		if !pathFinder.walkable(x, y) {
+			return Point{}, false
+		}
+		if x == goal.X && y == goal.Y {
+			return goal, true
+		}
+
+		switch {
+		case dx != 0 && dy != 0:
+			// 斜向移动时,水平或垂直方向上存在跳点,则当前格子为跳点
+			if _, ok := pathFinder.jump(x+dx, y, dx, 0, goal); ok {
+				return Point{x, y}, true
+			}
+			if _, ok := pathFinder.jump(x, y+dy, 0, dy, goal); ok {
+				return Point{x, y}, true
+			}
+			if !pathFinder.walkable(x+dx, y) || !pathFinder.walkable(x, y+dy) {
+				return Point{}, false
+			}
+		case dx != 0:
+			if (pathFinder.walkable(x, y-1) && !pathFinder.walkable(x-dx, y-1)) ||
+				(pathFinder.walkable(x, y+1) && !pathFinder.walkable(x-dx, y+1)) {
+				return Point{x, y}, true
+			}
+		default:
+			if (pathFinder.walkable(x-1, y) && !pathFinder.walkable(x-1, y-dy)) ||
+				(pathFinder.walkable(x+1, y) && !pathFinder.walkable(x+1, y-dy)) {
+				return Point{x, y}, true
+			}
+		}
+
+		x, y = x+dx, y+dy
+	}
+}
+
+func (pathFinder *PathFinder) buildPath(goalIdx int32, jump bool, dst []Point) []Point {
+	rev := pathFinder.rbuf[:0]
+	for idx := goalIdx; idx >= 0; idx = pathFinder.parent[idx] {
+		rev = append(rev, pathFinder.point(idx))
+	}
+	pathFinder.rbuf = rev
+
+	for i := len(rev) - 1; i >= 0; i-- {
+		p := rev[i]
+		if jump && len(dst) > 0 {
+			// 跳点之间在同一直线或对角线上,补全中间格子
+			last := dst[len(dst)-1]
+			dx, dy := sign(p.X-last.X), sign(p.Y-last.Y)
+			for q := (Point{last.X + dx, last.Y + dy}); q != p; q = (Point{q.X + dx, q.Y + dy}) {
+				dst = append(dst, q)
+			}
+		}
+		dst = append(dst, p)
+	}
+
+	if pathFinder.opts.Smooth {
+		dst = pathFinder.smooth(dst)
+	}
+	return dst
+}
+
+// 视线平滑: 保留无法直线到达的拐点
+func (pathFinder *PathFinder) smooth(path []Point) []Point {
+	if len(path) < 3 {
+		return path
+	}
+
+	out := 1
+	anchor := path[0]
+	for i := 2; i < len(path); i++ {
+		if pathFinder.lineWalkable(anchor, path[i]) {
+			continue
+		}
+		anchor = path[i-1]
+		path[out] = anchor
+		out++
+	}
+	path[out] = path[len(path)-1]
+	return path[:out+1]
+}
+
+// a到b的直线经过的格子是否都能按移动规则通过
+func (pathFinder *PathFinder) lineWalkable(a, b Point) bool {
+	return traceLine(a, b, func(prev, cur Point) bool {
+		return pathFinder.canStep(prev.X, prev.Y, cur.X-prev.X, cur.Y-prev.Y)
+	})
+}
+
+// Bresenham画线,依次回调相邻两格,visit返回false时中止并返回false.
+func traceLine(a, b Point, visit func(prev, cur Point) bool) bool {
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := sign(b.X-a.X), sign(b.Y-a.Y)
+	err := dx + dy
+	cur := a
+	for cur != b {
+		prev := cur
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			cur.X += sx
+		}
+		if e2 <= dx {
+			err += dx
+			cur.Y += sy
+		}
+		if !visit(prev, cur) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,210 @@
+package gamedb
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// 按行描述的地图, '#'为阻挡, 其他字符可行走
+func newTestSceneMap(rows ...string) *SceneMap {
+	sceneMap := &SceneMap{Width: len(rows[0]), Height: len(rows)}
+	sceneMap.flags = make([]uint8, sceneMap.Width*sceneMap.Height)
+	for y, row := range rows {
+		for x := range row {
+			if row[x] != '#' {
+				sceneMap.flags[y*sceneMap.Width+x] = uint8(FlagWalkable)
+			}
+		}
+	}
+	return sceneMap
+}
+
+// 随机地图, blocked为阻挡格子的比例
+func randomSceneMap(r *rand.Rand, width, height int, blocked float64) *SceneMap {
+	sceneMap := &SceneMap{Width: width, Height: height, flags: make([]uint8, width*height)}
+	for i := range sceneMap.flags {
+		if r.Float64() >= blocked {
+			sceneMap.flags[i] = uint8(FlagWalkable)
+		}
+	}
+	return sceneMap
+}
+
+func randomWalkable(r *rand.Rand, sceneMap *SceneMap) Point {
+	for {
+		p := Point{r.Intn(sceneMap.Width), r.Intn(sceneMap.Height)}
+		if sceneMap.IsWalkable(p.X, p.Y) {
+			return p
+		}
+	}
+}
+
+// 检查路径的起点终点和每一步都符合移动规则, 返回路径代价
+func checkPath(t *testing.T, pathFinder *PathFinder, path []Point, start, goal Point) int32 {
+	t.Helper()
+	if len(path) == 0 || path[0] != start || path[len(path)-1] != goal {
+		t.Fatalf("path %v does not go from %v to %v", path, start, goal)
+	}
+	var cost int32
+	for i := 1; i < len(path); i++ {
+		prev, cur := path[i-1], path[i]
+		dx, dy := cur.X-prev.X, cur.Y-prev.Y
+		if abs(dx) > 1 || abs(dy) > 1 || !pathFinder.canStep(prev.X, prev.Y, dx, dy) {
+			t.Fatalf("path %v has an illegal step %v -> %v", path, prev, cur)
+		}
+		cost += pathFinder.distance(prev, cur)
+	}
+	return cost
+}
+
+func TestJumpPointMatchesAStar(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	found := 0
+	for i := 0; i < 200; i++ {
+		sceneMap := randomSceneMap(r, 40, 30, 0.3)
+		start, goal := randomWalkable(r, sceneMap), randomWalkable(r, sceneMap)
+
+		aStar := NewPathFinder(sceneMap, PathOptions{Diagonal: true})
+		jps := NewPathFinder(sceneMap, PathOptions{Diagonal: true, JumpPoint: true})
+		aStarPath, aStarErr := aStar.FindPath(start, goal, nil)
+		jpsPath, jpsErr := jps.FindPath(start, goal, nil)
+		if aStarErr != jpsErr {
+			t.Fatalf("map %d %v -> %v : A* err %v, JPS err %v", i, start, goal, aStarErr, jpsErr)
+		}
+		if aStarErr != nil {
+			continue
+		}
+
+		aStarCost := checkPath(t, aStar, aStarPath, start, goal)
+		jpsCost := checkPath(t, jps, jpsPath, start, goal)
+		if aStarCost != jpsCost {
+			t.Fatalf("map %d %v -> %v : A* cost %d, JPS cost %d", i, start, goal, aStarCost, jpsCost)
+		}
+		found++
+	}
+	if found < 50 {
+		t.Fatalf("only %d of 200 searches found a path", found)
+	}
+}
+
+func TestPathCornerRules(t *testing.T) {
+	tests := []struct {
+		rows []string
+		opts PathOptions
+		cost int32 // <0 没有路径
+	}{
+		{[]string{"..", ".."}, PathOptions{}, 20},
+		{[]string{"..", ".."}, PathOptions{Diagonal: true}, 14},
+		{[]string{".#", ".."}, PathOptions{Diagonal: true, Corner: CornerNever}, 20},
+		{[]string{".#", ".."}, PathOptions{Diagonal: true, Corner: CornerNever, JumpPoint: true}, 20},
+		{[]string{".#", ".."}, PathOptions{Diagonal: true, Corner: CornerOneSide}, 14},
+		{[]string{".#", ".."}, PathOptions{Diagonal: true, Corner: CornerAlways}, 14},
+		{[]string{".#", "#."}, PathOptions{Diagonal: true, Corner: CornerNever}, -1},
+		{[]string{".#", "#."}, PathOptions{Diagonal: true, Corner: CornerOneSide}, -1},
+		{[]string{".#", "#."}, PathOptions{Diagonal: true, Corner: CornerAlways}, 14},
+		{[]string{".#", "#."}, PathOptions{Corner: CornerAlways}, -1},
+	}
+	for i, test := range tests {
+		sceneMap := newTestSceneMap(test.rows...)
+		pathFinder := NewPathFinder(sceneMap, test.opts)
+		start, goal := Point{0, 0}, Point{1, 1}
+		path, err := pathFinder.FindPath(start, goal, nil)
+		if test.cost < 0 {
+			if !errors.Is(err, ErrNoPath) {
+				t.Errorf("case %d : got path %v err %v, want ErrNoPath", i, path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d : %v", i, err)
+			continue
+		}
+		if cost := checkPath(t, pathFinder, path, start, goal); cost != test.cost {
+			t.Errorf("case %d : path %v cost %d, want %d", i, path, cost, test.cost)
+		}
+	}
+}
+
+func TestPathErrors(t *testing.T) {
+	sceneMap := newTestSceneMap(
+		"..........",
+		"..........",
+		"..........",
+		"........#.",
+	)
+	if _, err := sceneMap.FindPath(Point{0, 0}, Point{8, 3}, PathOptions{}); !errors.Is(err, ErrPointNotWalkable) {
+		t.Fatalf("blocked goal : %v", err)
+	}
+	if _, err := sceneMap.FindPath(Point{-1, 0}, Point{1, 1}, PathOptions{}); !errors.Is(err, ErrPointNotWalkable) {
+		t.Fatalf("start out of map : %v", err)
+	}
+	if path, err := sceneMap.FindPath(Point{2, 2}, Point{2, 2}, PathOptions{}); err != nil || len(path) != 1 {
+		t.Fatalf("start == goal : %v %v", path, err)
+	}
+
+	// 终点不在起点的邻居中, 只展开2个节点无法到达
+	for _, jump := range []bool{false, true} {
+		opts := PathOptions{Diagonal: jump, JumpPoint: jump, MaxNodes: 2}
+		if _, err := sceneMap.FindPath(Point{0, 0}, Point{9, 3}, opts); !errors.Is(err, ErrSearchLimit) {
+			t.Fatalf("jump %v : MaxNodes 2 got %v, want ErrSearchLimit", jump, err)
+		}
+		opts.MaxNodes = 0
+		if _, err := sceneMap.FindPath(Point{0, 0}, Point{9, 3}, opts); err != nil {
+			t.Fatalf("jump %v : unlimited search : %v", jump, err)
+		}
+	}
+}
+
+// 多次寻路复用PathFinder的缓存, 结果与新建的PathFinder一致
+func TestPathFinderReuse(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	sceneMap := randomSceneMap(r, 30, 30, 0.25)
+	pathFinder := NewPathFinder(sceneMap, PathOptions{Diagonal: true})
+	var path []Point
+	for i := 0; i < 50; i++ {
+		start, goal := randomWalkable(r, sceneMap), randomWalkable(r, sceneMap)
+		var err error
+		path, err = pathFinder.FindPath(start, goal, path)
+		want, wantErr := sceneMap.FindPath(start, goal, PathOptions{Diagonal: true})
+		if err != wantErr {
+			t.Fatalf("%v -> %v : err %v, want %v", start, goal, err, wantErr)
+		}
+		if err == nil && checkPath(t, pathFinder, path, start, goal) != checkPath(t, pathFinder, want, start, goal) {
+			t.Fatalf("%v -> %v : reused %v, new %v", start, goal, path, want)
+		}
+	}
+}
+
+func TestPathSmooth(t *testing.T) {
+	open := newTestSceneMap(
+		"........",
+		"........",
+		"........",
+	)
+	path, err := open.FindPath(Point{0, 0}, Point{7, 2}, PathOptions{Diagonal: true, Smooth: true})
+	if err != nil || len(path) != 2 {
+		t.Fatalf("open map smooth path %v %v, want start and goal only", path, err)
+	}
+
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 100; i++ {
+		sceneMap := randomSceneMap(r, 30, 30, 0.25)
+		opts := PathOptions{Diagonal: true, Corner: CornerRule(i % 3), Smooth: true}
+		pathFinder := NewPathFinder(sceneMap, opts)
+		start, goal := randomWalkable(r, sceneMap), randomWalkable(r, sceneMap)
+		path, err := pathFinder.FindPath(start, goal, nil)
+		if err != nil {
+			continue
+		}
+		if path[0] != start || path[len(path)-1] != goal {
+			t.Fatalf("smooth path %v does not go from %v to %v", path, start, goal)
+		}
+		// 相邻拐点之间直线可达
+		for j := 1; j < len(path); j++ {
+			if !pathFinder.lineWalkable(path[j-1], path[j]) {
+				t.Fatalf("smooth path %v : %v -> %v not walkable", path, path[j-1], path[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package gamedb
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+var (
+	colorBlocked  = color.RGBA{40, 40, 40, 255}
+	colorWalkable = color.RGBA{220, 220, 220, 255}
+	colorGrid     = color.RGBA{128, 128, 128, 255}
+	colorPath     = color.RGBA{230, 30, 30, 255}
+	colorPoint    = color.RGBA{30, 90, 230, 255}
+)
+
+// 图层颜色(bit1~bit7),叠加在可行走/不可行走底色上
+var layerColors = [8]color.RGBA{
+	{},
+	{60, 200, 60, 255},  // bit1 安全区
+	{60, 140, 230, 255}, // bit2 水域
+	{230, 160, 40, 255},
+	{180, 60, 200, 255},
+	{40, 200, 200, 255},
+	{200, 200, 40, 255},
+	{230, 90, 140, 255},
+}
+
+type RenderOptions struct {
+	Scale  float64  // 像素缩放, 1表示每个格子CellWidth*CellHeight像素, <=0时为1
+	Layers RoadFlag // 需要着色的图层(不含FlagWalkable)
+	Grid   bool     // 绘制格子线
+	Path   []Point  // 叠加显示的路径
+	Points []Point  // 叠加显示的坐标点
+}
+
+// 将地图渲染为PNG,用于与编辑器导出结果对比.
+func (sceneMap *SceneMap) RenderPNG(w io.Writer, opts RenderOptions) error {
+	return png.Encode(w, sceneMap.Render(opts))
+}
+
+func (sceneMap *SceneMap) Render(opts RenderOptions) *image.RGBA {
+	scale := opts.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	cellW, cellH := int(CellWidth*scale), int(CellHeight*scale)
+	if cellW < 1 {
+		cellW = 1
+	}
+	if cellH < 1 {
+		cellH = 1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, sceneMap.Width*cellW, sceneMap.Height*cellH))
+	fillCell := func(x, y int, c color.RGBA, inset int) {
+		for py := y*cellH + inset; py < (y+1)*cellH-inset; py++ {
+			for px := x*cellW + inset; px < (x+1)*cellW-inset; px++ {
+				img.SetRGBA(px, py, c)
+			}
+		}
+	}
+
+	for y := 0; y < sceneMap.Height; y++ {
+		for x := 0; x < sceneMap.Width; x++ {
+			flags := sceneMap.Flags(x, y)
+			c := colorBlocked
+			if flags&FlagWalkable != 0 {
+				c = colorWalkable
+			}
+			for bit := 1; bit < len(layerColors); bit++ {
+				layer := RoadFlag(1 << bit)
+				if opts.Layers&layer != 0 && flags&layer != 0 {
+					c = blend(c, layerColors[bit])
+				}
+			}
+			fillCell(x, y, c, 0)
+		}
+	}
+
+	if opts.Grid && cellW > 2 && cellH > 2 {
+		for y := 0; y < img.Bounds().Dy(); y++ {
+			for x := 0; x < img.Bounds().Dx(); x++ {
+				if x%cellW == 0 || y%cellH == 0 {
+					img.SetRGBA(x, y, colorGrid)
+				}
+			}
+		}
+	}
+
+	// 路径和坐标点内缩绘制,保留底色便于辨认
+	inset := cellW / 4
+	if cellH/4 < inset {
+		inset = cellH / 4
+	}
+	for i, p := range opts.Path {
+		if i > 0 {
+			traceLine(opts.Path[i-1], p, func(_, cur Point) bool {
+				fillCell(cur.X, cur.Y, colorPath, inset)
+				return true
+			})
+		} else {
+			fillCell(p.X, p.Y, colorPath, inset)
+		}
+	}
+	for _, p := range opts.Points {
+		fillCell(p.X, p.Y, colorPoint, inset)
+	}
+
+	return img
+}
+
+func blend(a, b color.RGBA) color.RGBA {
+	return color.RGBA{
+		R: uint8((uint16(a.R) + uint16(b.R)) / 2),
+		G: uint8((uint16(a.G) + uint16(b.G)) / 2),
+		B: uint8((uint16(a.B) + uint16(b.B)) / 2),
+		A: 255,
+	}
+}
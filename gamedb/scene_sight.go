@@ -0,0 +1,106 @@
+package gamedb
+
+// 范围形状
+type RadiusShape int
+
+const (
+	ShapeCircle  RadiusShape = iota // 圆形: dx*dx+dy*dy <= r*r
+	ShapeDiamond                    // 菱形: |dx|+|dy| <= r
+)
+
+func inShape(dx, dy, radius int, shape RadiusShape) bool {
+	if shape == ShapeDiamond {
+		return abs(dx)+abs(dy) <= radius
+	}
+	return dx*dx+dy*dy <= radius*radius
+}
+
+// a,b之间的Bresenham直线经过的格子(含两端)是否都可行走
+func (sceneMap *SceneMap) LineOfSight(a, b Point) bool {
+	if !sceneMap.IsWalkable(a.X, a.Y) {
+		return false
+	}
+	return traceLine(a, b, func(_, cur Point) bool {
+		return sceneMap.IsWalkable(cur.X, cur.Y)
+	})
+}
+
+// 从from向to发射射线,遇到不可行走的格子停止.
+// 返回射线停止前最后一个可行走的格子, blocked表示是否被阻挡(未到达to).
+// from不可行走时返回from和true.
+func (sceneMap *SceneMap) Raycast(from, to Point) (last Point, blocked bool) {
+	last = from
+	if !sceneMap.IsWalkable(from.X, from.Y) {
+		return from, true
+	}
+	blocked = !traceLine(from, to, func(_, cur Point) bool {
+		if !sceneMap.IsWalkable(cur.X, cur.Y) {
+			return false
+		}
+		last = cur
+		return true
+	})
+	return last, blocked
+}
+
+// 沿(dx,dy)方向发射最远distance格的射线(dx,dy为任意方向向量)
+func (sceneMap *SceneMap) RaycastDir(from Point, dx, dy int, distance int) (Point, bool) {
+	if dx == 0 && dy == 0 {
+		return from, !sceneMap.IsWalkable(from.X, from.Y)
+	}
+	// 按较长轴缩放到distance格
+	long := abs(dx)
+	if abs(dy) > long {
+		long = abs(dy)
+	}
+	to := Point{from.X + dx*distance/long, from.Y + dy*distance/long}
+	return sceneMap.Raycast(from, to)
+}
+
+// center周围radius格内所有可行走的格子,结果追加到dst.
+func (sceneMap *SceneMap) CellsInRadius(dst []Point, center Point, radius int, shape RadiusShape) []Point {
+	minX, maxX := center.X-radius, center.X+radius
+	minY, maxY := center.Y-radius, center.Y+radius
+	if minX < 0 {
+		minX = 0
+	}
+	if minY < 0 {
+		minY = 0
+	}
+	if maxX >= sceneMap.Width {
+		maxX = sceneMap.Width - 1
+	}
+	if maxY >= sceneMap.Height {
+		maxY = sceneMap.Height - 1
+	}
+
+	for y := minY; y <= maxY; y++ {
+		row := sceneMap.flags[y*sceneMap.Width : (y+1)*sceneMap.Width]
+		for x := minX; x <= maxX; x++ {
+			if row[x]&uint8(FlagWalkable) != 0 && inShape(x-center.X, y-center.Y, radius, shape) {
+				dst = append(dst, Point{x, y})
+			}
+		}
+	}
+	return dst
+}
+
+// 视野: center周围radius格内可行走且与center之间视线无阻挡的格子,结果追加到dst.
+// 每个格子单独检查视线, 耗时约为O(radius³), 大半径高频调用时应缓存结果(见BenchmarkVisibleCells).
+func (sceneMap *SceneMap) VisibleCells(dst []Point, center Point, radius int, shape RadiusShape) []Point {
+	if !sceneMap.IsWalkable(center.X, center.Y) {
+		return dst
+	}
+
+	start := len(dst)
+	dst = sceneMap.CellsInRadius(dst, center, radius, shape)
+
+	out := start
+	for _, p := range dst[start:] {
+		if sceneMap.LineOfSight(center, p) {
+			dst[out] = p
+			out++
+		}
+	}
+	return dst[:out]
+}
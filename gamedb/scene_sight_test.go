@@ -0,0 +1,108 @@
+package gamedb
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestLineOfSight(t *testing.T) {
+	sceneMap := newTestSceneMap(
+		"......",
+		"..#...",
+		"......",
+	)
+	tests := []struct {
+		a, b Point
+		want bool
+	}{
+		{Point{0, 1}, Point{5, 1}, false},
+		{Point{0, 0}, Point{5, 0}, true},
+		{Point{0, 0}, Point{4, 2}, false},
+		{Point{3, 0}, Point{3, 2}, true},
+		{Point{2, 1}, Point{2, 1}, false},
+	}
+	for _, test := range tests {
+		if got := sceneMap.LineOfSight(test.a, test.b); got != test.want {
+			t.Errorf("LineOfSight(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+
+	if last, blocked := sceneMap.Raycast(Point{0, 1}, Point{5, 1}); last != (Point{1, 1}) || !blocked {
+		t.Errorf("Raycast = %v %v, want (1, 1) blocked", last, blocked)
+	}
+	if last, blocked := sceneMap.RaycastDir(Point{0, 0}, 1, 0, 3); last != (Point{3, 0}) || blocked {
+		t.Errorf("RaycastDir = %v %v, want (3, 0) not blocked", last, blocked)
+	}
+}
+
+func TestVisibleCells(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	sceneMap := randomSceneMap(r, 50, 50, 0.2)
+	for i := 0; i < 20; i++ {
+		center := randomWalkable(r, sceneMap)
+		for _, shape := range []RadiusShape{ShapeCircle, ShapeDiamond} {
+			cells := sceneMap.CellsInRadius(nil, center, 8, shape)
+			visible := sceneMap.VisibleCells(nil, center, 8, shape)
+			// 结果为CellsInRadius中视线无阻挡的子序列
+			j := 0
+			for _, p := range cells {
+				if sceneMap.LineOfSight(center, p) {
+					if j >= len(visible) || visible[j] != p {
+						t.Fatalf("center %v : visible %v, missing %v", center, visible, p)
+					}
+					j++
+				}
+			}
+			if j != len(visible) {
+				t.Fatalf("center %v : visible has %d extra cells", center, len(visible)-j)
+			}
+		}
+	}
+}
+
+// 512x512格子的空地图(视线检查不会提前结束, 最坏情况)和20%阻挡的地图
+func benchSightMaps() map[string]*SceneMap {
+	maps := map[string]*SceneMap{
+		"open":    randomSceneMap(rand.New(rand.NewSource(1)), 512, 512, 0),
+		"blocked": randomSceneMap(rand.New(rand.NewSource(1)), 512, 512, 0.2),
+	}
+	for _, sceneMap := range maps {
+		sceneMap.flags[256*sceneMap.Width+256] = uint8(FlagWalkable)
+	}
+	return maps
+}
+
+func BenchmarkLineOfSight(b *testing.B) {
+	center := Point{256, 256}
+	for name, sceneMap := range benchSightMaps() {
+		for _, distance := range []int{10, 30, 100} {
+			b.Run(fmt.Sprintf("%s/distance%d", name, distance), func(b *testing.B) {
+				r := rand.New(rand.NewSource(2))
+				targets := make([]Point, 1024)
+				for i := range targets {
+					targets[i] = Point{center.X + r.Intn(2*distance+1) - distance, center.Y + r.Intn(2*distance+1) - distance}
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					sceneMap.LineOfSight(center, targets[i%len(targets)])
+				}
+			})
+		}
+	}
+}
+
+// 常见视野半径: 怪物索敌约10格, 玩家视野约20格, 大型地图/技能预览约40格
+func BenchmarkVisibleCells(b *testing.B) {
+	center := Point{256, 256}
+	for name, sceneMap := range benchSightMaps() {
+		for _, radius := range []int{10, 20, 40} {
+			b.Run(fmt.Sprintf("%s/radius%d", name, radius), func(b *testing.B) {
+				var dst []Point
+				for i := 0; i < b.N; i++ {
+					dst = sceneMap.VisibleCells(dst[:0], center, radius, ShapeCircle)
+				}
+			})
+		}
+	}
+}
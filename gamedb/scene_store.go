@@ -0,0 +1,229 @@
+package gamedb
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// 每张地图除网格外的估算内存(结构体,LRU节点等)
+const sceneMapOverhead = 256
+
+type SceneOptions struct {
+	Lazy         bool  // true : 首次GetSceneMap时加载; false : 加载配置时全部预加载(线上默认)
+	MaxParallel  int   // 同时加载的地图数量, <=0时为GOMAXPROCS
+	MemoryBudget int64 // 懒加载的地图内存预算(字节), 超出后淘汰最久未使用的地图, <=0不淘汰. 预加载时地图常驻, 不淘汰
+}
+
+// 正在加载的地图,并发的首次请求共享同一次加载.
+// 加载使用发起者的ctx, 发起者取消导致的失败不返回给其他等待者, 等待者重新发起加载.
+type sceneCall struct {
+	done     chan struct{}
+	sceneMap *SceneMap
+	err      error
+}
+
+type sceneEntry struct {
+	id       int
+	sceneMap *SceneMap
+	size     int64
+}
+
+// 地图仓库,负责按需加载,限制并发和LRU淘汰.
+type sceneStore struct {
+	scenePath string           // map_%d.json路径模板
+	opts      SceneOptions     //
+	cache     CachePolicy      // 二进制缓存(map_%d.bin)的读写策略, 与.dat一致
+	mapIds    map[int]struct{} // Scenes引用的地图,其余id不加载
+	onLoad    func(*SceneMap)  // 懒加载完成后的回调(连通性检查等)
+	sem       chan struct{}    // 并发加载数量限制
+
+	lock    sync.Mutex
+	entries map[int]*list.Element // value : *sceneEntry
+	lru     *list.List            // 头部为最近使用
+	loading map[int]*sceneCall
+	memUsed int64
+}
+
+func newSceneStore(scenePath string, mapIds []int, opts SceneOptions) *sceneStore {
+	parallel := opts.MaxParallel
+	if parallel <= 0 {
+		parallel = runtime.GOMAXPROCS(0)
+	}
+
+	store := &sceneStore{
+		scenePath: scenePath,
+		opts:      opts,
+		mapIds:    make(map[int]struct{}, len(mapIds)),
+		sem:       make(chan struct{}, parallel),
+		entries:   make(map[int]*list.Element),
+		lru:       list.New(),
+		loading:   make(map[int]*sceneCall),
+	}
+	for _, id := range mapIds {
+		store.mapIds[id] = struct{}{}
+	}
+	return store
+}
+
+// 获取地图,懒加载模式下首次调用时加载. 地图不存在或加载失败返回nil.
+func (gameDB *GameDB) GetSceneMap(id int) *SceneMap {
+	sceneMap, err := gameDB.LoadSceneMapById(id)
+	if err != nil {
+		gameDB.logf("GetSceneMap() map %d err : %v\n", id, err)
+	}
+	return sceneMap
+}
+
+// 同GetSceneMap,返回加载错误
+func (gameDB *GameDB) LoadSceneMapById(id int) (*SceneMap, error) {
+	if nil == gameDB.scenes {
+		return nil, fmt.Errorf("scenes not loaded")
+	}
+	return gameDB.scenes.get(context.Background(), id)
+}
+
+// 从包级Load加载的GameDB获取地图
+func GetSceneMap(id int) *SceneMap {
+	sceneMap, err := LoadSceneMapById(id)
+	if err != nil {
+		fmt.Printf("GetSceneMap() map %d err : %v\n", id, err)
+	}
+	return sceneMap
+}
+
+// 同GetSceneMap,返回加载错误
+func LoadSceneMapById(id int) (*SceneMap, error) {
+	gameDB := getDefaultGameDB()
+	if nil == gameDB {
+		return nil, fmt.Errorf("scenes not loaded")
+	}
+	return gameDB.LoadSceneMapById(id)
+}
+
+// ctx取消时放弃等待和加载,返回ctx.Err()
+func (store *sceneStore) get(ctx context.Context, id int) (*SceneMap, error) {
+	if _, ok := store.mapIds[id]; !ok {
+		return nil, nil
+	}
+
+	for {
+		store.lock.Lock()
+		if elem, ok := store.entries[id]; ok {
+			store.lru.MoveToFront(elem)
+			store.lock.Unlock()
+			return elem.Value.(*sceneEntry).sceneMap, nil
+		}
+
+		call, ok := store.loading[id]
+		if !ok {
+			call = &sceneCall{done: make(chan struct{})}
+			store.loading[id] = call
+			store.lock.Unlock()
+			return store.load(ctx, id, call)
+		}
+		store.lock.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// 发起者的ctx取消了加载,本次请求的ctx仍有效时重新加载
+		if isContextErr(call.err) && nil == ctx.Err() {
+			continue
+		}
+		return call.sceneMap, call.err
+	}
+}
+
+func (store *sceneStore) load(ctx context.Context, id int, call *sceneCall) (*SceneMap, error) {
+	select {
+	case store.sem <- struct{}{}:
+		call.sceneMap, call.err = loadSceneMap(ctx, makeMapPath(store.scenePath, id), id, store.cache)
+		<-store.sem
+	case <-ctx.Done():
+		call.err = ctx.Err()
+	}
+
+	if nil == call.err && store.onLoad != nil {
+		store.onLoad(call.sceneMap)
+	}
+
+	store.lock.Lock()
+	delete(store.loading, id)
+	if nil == call.err {
+		store.add(id, call.sceneMap)
+	}
+	store.lock.Unlock()
+
+	close(call.done)
+	return call.sceneMap, call.err
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// 调用方持有lock
+func (store *sceneStore) add(id int, sceneMap *SceneMap) {
+	entry := &sceneEntry{id: id, sceneMap: sceneMap, size: int64(sceneMap.MemSize() + sceneMapOverhead)}
+	store.entries[id] = store.lru.PushFront(entry)
+	store.memUsed += entry.size
+
+	// 预加载的地图全部常驻, 淘汰后GetSceneMap会重新读取文件
+	if !store.opts.Lazy || store.opts.MemoryBudget <= 0 {
+		return
+	}
+
+	// 至少保留刚加载的地图
+	for store.memUsed > store.opts.MemoryBudget && store.lru.Len() > 1 {
+		elem := store.lru.Back()
+		evicted := elem.Value.(*sceneEntry)
+		store.lru.Remove(elem)
+		delete(store.entries, evicted.id)
+		store.memUsed -= evicted.size
+	}
+}
+
+// 预加载全部地图(并发数受MaxParallel限制),返回已加载的地图
+func (store *sceneStore) preload(ctx context.Context) (map[int]*SceneMap, error) {
+	var info string = ""
+	var lock sync.Mutex
+	var waiter sync.WaitGroup
+	loaded := make(map[int]*SceneMap, len(store.mapIds))
+
+	waiter.Add(len(store.mapIds))
+	for id := range store.mapIds {
+		go func(mapId int) {
+			defer waiter.Done()
+			sceneMap, err := store.get(ctx, mapId)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				info += fmt.Sprintf("%s,\n", err.Error())
+				return
+			}
+			loaded[mapId] = sceneMap
+		}(id)
+	}
+	waiter.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if info != "" {
+		return nil, fmt.Errorf(info)
+	}
+	return loaded, nil
+}
+
+// 当前缓存的地图数量和估算内存
+func (store *sceneStore) stats() (int, int64) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.lru.Len(), store.memUsed
+}
@@ -0,0 +1,151 @@
+package gamedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 写入4x3格子的地图文件, 返回map_%d.json路径模板
+func writeTestSceneMaps(t *testing.T, ids ...int) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, id := range ids {
+		content := fmt.Sprintf(`{"Id":%d,"Width":%d,"Height":%d,"RoadFlags":{"0":1,"1001":1}}`, id, CellWidth*4, CellHeight*3)
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("map_%d.json", id)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "map_%d.json")
+}
+
+func TestSceneStoreSharesLoad(t *testing.T) {
+	store := newSceneStore(writeTestSceneMaps(t, 1), []int{1}, SceneOptions{Lazy: true})
+	maps := make([]*SceneMap, 10)
+	var waiter sync.WaitGroup
+	for i := range maps {
+		waiter.Add(1)
+		go func(i int) {
+			defer waiter.Done()
+			sceneMap, err := store.get(context.Background(), 1)
+			if err != nil {
+				t.Error(err)
+			}
+			maps[i] = sceneMap
+		}(i)
+	}
+	waiter.Wait()
+	for _, sceneMap := range maps {
+		if nil == sceneMap || sceneMap != maps[0] {
+			t.Fatalf("get returned different maps %p %p", sceneMap, maps[0])
+		}
+	}
+	if sceneMap, err := store.get(context.Background(), 2); sceneMap != nil || err != nil {
+		t.Fatalf("map not referenced by Scenes : %v %v", sceneMap, err)
+	}
+}
+
+// 发起加载的请求取消后, 等待同一张地图的其他请求重新加载而不是返回取消错误
+func TestSceneStoreRetriesCanceledLoad(t *testing.T) {
+	store := newSceneStore(writeTestSceneMaps(t, 1), []int{1}, SceneOptions{Lazy: true, MaxParallel: 1})
+	store.sem <- struct{}{} // 占满并发数, 加载停在等待sem
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := store.get(ctx, 1)
+		first <- err
+	}()
+	for loading := false; !loading; {
+		store.lock.Lock()
+		_, loading = store.loading[1]
+		store.lock.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	type result struct {
+		sceneMap *SceneMap
+		err      error
+	}
+	second := make(chan result, 1)
+	go func() {
+		sceneMap, err := store.get(context.Background(), 1)
+		second <- result{sceneMap, err}
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled get returned %v", err)
+	}
+	<-store.sem
+	if r := <-second; r.err != nil || nil == r.sceneMap {
+		t.Fatalf("waiting get returned %v %v", r.sceneMap, r.err)
+	}
+}
+
+// 预加载的地图不受MemoryBudget淘汰, 懒加载时只保留预算内的地图
+func TestSceneStoreMemoryBudget(t *testing.T) {
+	scenePath := writeTestSceneMaps(t, 1, 2, 3)
+	ids := []int{1, 2, 3}
+
+	eager := newSceneStore(scenePath, ids, SceneOptions{MemoryBudget: 1})
+	loaded, err := eager.preload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := eager.stats(); len(loaded) != 3 || count != 3 {
+		t.Fatalf("eager store loaded %d maps, cached %d, want 3", len(loaded), count)
+	}
+
+	lazy := newSceneStore(scenePath, ids, SceneOptions{Lazy: true, MemoryBudget: 1})
+	for _, id := range ids {
+		if sceneMap, err := lazy.get(context.Background(), id); err != nil || nil == sceneMap {
+			t.Fatalf("lazy get %d : %v %v", id, sceneMap, err)
+		}
+	}
+	if count, _ := lazy.stats(); count != 1 {
+		t.Fatalf("lazy store cached %d maps, want 1", count)
+	}
+}
+
+// 预加载中途取消, 返回ctx.Err()且加载goroutine全部退出
+func TestSceneStoreCancelPreload(t *testing.T) {
+	ids := make([]int, 16)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	store := newSceneStore(writeTestSceneMaps(t, ids...), ids, SceneOptions{MaxParallel: 1})
+	store.sem <- struct{}{} // 占满并发数, 所有地图停在等待sem
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.preload(ctx)
+		done <- err
+	}()
+	for loading := 0; loading < len(ids); {
+		store.lock.Lock()
+		loading = len(store.loading)
+		store.lock.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled preload returned %v", err)
+	}
+	checkGoroutines(t, before)
+
+	<-store.sem
+	if count, _ := store.stats(); count != 0 {
+		t.Fatalf("%d maps cached after cancel", count)
+	}
+}
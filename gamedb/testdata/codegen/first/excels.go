@@ -0,0 +1,15 @@
+package gamedb
+
+// 所有表格文件
+func DefaultRegistry() *Registry {
+	registry := &Registry{}
+	// sheettool gen registry begin
+	registry.register("hero.csv",
+		mapSheet("hero", &Hero{}, "Heroes", "Id"),
+	)
+	registry.register("shop.csv",
+		mapSheet("shop", &Shop{}, "Shops", "Id"),
+	)
+	// sheettool gen registry end
+	return registry
+}
@@ -0,0 +1,12 @@
+package gamedb
+
+import "time"
+
+// 表格行结构体
+
+// shop (shop.csv)
+type Shop struct {
+	Id    int       `col:"id" client:"id"`       //编号
+	Price PropInfo  `col:"price" client:"price"` //价格
+	Open  time.Time `col:"open" client:"open"`   //开放时间
+}
@@ -0,0 +1,10 @@
+package gamedb
+
+type GameDB struct {
+	report *LoadReport // 加载报告
+
+	// sheettool gen fields begin
+	Heroes map[int]*Hero `client:"heroes,map" mapKey:"Id"` // 英雄
+	Shops  map[int]*Shop `client:"shops,map" mapKey:"Id"`
+	// sheettool gen fields end
+}
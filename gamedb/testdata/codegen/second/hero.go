@@ -0,0 +1,19 @@
+package gamedb
+
+import (
+	"fmt"
+)
+
+// 英雄
+type Hero struct {
+	Id     int    `col:"id" client:"id"`                 //编号
+	Title  string `col:"title" client:"title"`           //称号
+	Skills []int  `col:"skills" client:"skills" sep:","` //技能
+	Desc   string `col:"desc" client:"desc"`             //描述
+	Power  int    //战力, 由loader计算
+}
+
+// 手写方法, 重新生成时保留
+func (hero *Hero) String() string {
+	return fmt.Sprintf("hero %d", hero.Id)
+}
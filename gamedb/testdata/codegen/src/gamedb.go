@@ -0,0 +1,9 @@
+package gamedb
+
+type GameDB struct {
+	report *LoadReport // 加载报告
+
+	// sheettool gen fields begin
+	Heroes map[int]*Hero `client:"heroes,map" mapKey:"Id"` // 英雄
+	// sheettool gen fields end
+}
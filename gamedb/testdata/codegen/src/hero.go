@@ -0,0 +1,17 @@
+package gamedb
+
+import (
+	"fmt"
+)
+
+// 英雄
+type Hero struct {
+	Id    int    `col:"id" client:"id"`
+	Name  string `col:"name"` //名字
+	Power int    //战力, 由loader计算
+}
+
+// 手写方法, 重新生成时保留
+func (hero *Hero) String() string {
+	return fmt.Sprintf("hero %d", hero.Id)
+}
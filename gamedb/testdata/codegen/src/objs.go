@@ -0,0 +1,3 @@
+package gamedb
+
+// 表格行结构体
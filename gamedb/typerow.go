@@ -0,0 +1,272 @@
+package gamedb
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 类型行(可选): 标题行的上一行, 起始列(Id列)填写了基础类型(e.g : int)时作为类型行, 标注每一列的数据类型.
+// 加载时与Go field的类型对照检查, 不一致时加载失败; 空单元格不检查.
+//   int, uint, float, bool, string, datetime, duration   基础类型,时间和时长
+//   int[], int[][]                                     slice/array(每个[]一层)
+//   ItemInfos, PropInfo, TimeOfDay                     Go类型名
+//   ref:Items                                          引用GameDB.Items的key(map的key或slice元素的Id), 所有表格加载后检查
+
+const annotationRef = "ref:"
+
+var basicAnnotations = map[string]func(reflect.Type) bool{
+	"int": func(t reflect.Type) bool {
+		return t != durationType && t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64
+	},
+	"uint": func(t reflect.Type) bool {
+		return t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64
+	},
+	"float": func(t reflect.Type) bool {
+		return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+	},
+	"bool": func(t reflect.Type) bool {
+		return t.Kind() == reflect.Bool
+	},
+	"string": func(t reflect.Type) bool {
+		return t.Kind() == reflect.String
+	},
+	"datetime": func(t reflect.Type) bool {
+		return t == timeType
+	},
+	"duration": func(t reflect.Type) bool {
+		return t == durationType
+	},
+}
+
+// 是否为合法的类型标注(只检查写法)
+func isAnnotation(annotation string) bool {
+	if strings.HasPrefix(annotation, annotationRef) {
+		return len(annotation) > len(annotationRef)
+	}
+
+	base := strings.TrimRight(annotation, "[]")
+	if strings.Count(annotation[len(base):], "[]")*2 != len(annotation)-len(base) {
+		return false
+	}
+	if _, ok := basicAnnotations[base]; ok {
+		return true
+	}
+
+	// Go类型名
+	for i, r := range base {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return len(base) > 0 && unicode.IsUpper([]rune(base)[0])
+}
+
+// 起始列(Id列)为基础类型标注时才作为类型行, 避免把注释行(e.g : ID, 编号)当作类型行
+func isTypeRow(row []string, startCol int) bool {
+	if startCol-1 >= len(row) {
+		return false
+	}
+	_, ok := basicAnnotations[strings.TrimSpace(row[startCol-1])]
+	return ok
+}
+
+// 列对应的Go类型(多列字段为元素或结构体field的类型)
+func columnType(info *fieldInfo) reflect.Type {
+	t := info.field.Type
+	if info.elem >= 0 {
+		t = t.Elem()
+	}
+	if info.sub >= 0 {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		t = t.Field(info.sub).Type
+	}
+	return t
+}
+
+// 检查类型标注与列的Go类型是否一致, 返回引用的GameDB field(非ref标注为空)
+func checkAnnotation(annotation string, info *fieldInfo) (string, error) {
+	t := columnType(info)
+
+	if strings.HasPrefix(annotation, annotationRef) {
+		target := annotation[len(annotationRef):]
+		targetField, ok := reflect.TypeOf(GameDB{}).FieldByName(target)
+		if !ok || !(targetField.Type.Kind() == reflect.Map || targetField.Type.Kind() == reflect.Slice) {
+			return "", fmt.Errorf("type row says %s, GameDB has no map or slice field %s", annotation, target)
+		}
+		if !isRefKey(t) {
+			return "", fmt.Errorf("type row says %s, field %s is %s, ref needs int or string (or slice of them)", annotation, info.field.Name, t)
+		}
+		return target, nil
+	}
+
+	base := strings.TrimRight(annotation, "[]")
+	for depth := (len(annotation) - len(base)) / 2; depth > 0; depth-- {
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return "", fmt.Errorf("type row says %s, field %s is %s", annotation, info.field.Name, columnType(info))
+		}
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+
+	if match, ok := basicAnnotations[base]; ok {
+		if !match(t) {
+			return "", fmt.Errorf("type row says %s, field %s is %s", annotation, info.field.Name, columnType(info))
+		}
+		return "", nil
+	}
+	if t.Name() != base {
+		return "", fmt.Errorf("type row says %s, field %s is %s", annotation, info.field.Name, columnType(info))
+	}
+	return "", nil
+}
+
+func isRefKey(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.String:
+		return true
+	}
+	return false
+}
+
+// 对照类型行检查所有列, 返回ref列(列下标 -> 引用的GameDB field)
+func checkTypeRow(sheetName string, typeRow []string, colInfos columnInfos) (map[int]string, error) {
+	refs := make(map[int]string)
+	for j, info := range colInfos {
+		if j >= len(typeRow) {
+			continue
+		}
+		annotation := strings.TrimSpace(typeRow[j])
+		if len(annotation) == 0 {
+			continue
+		}
+		if !isAnnotation(annotation) {
+			return nil, fmt.Errorf("sheet ( %s ) column %s : unknown type %q in type row", sheetName, info.colName, annotation)
+		}
+		target, err := checkAnnotation(annotation, info)
+		if err != nil {
+			return nil, fmt.Errorf("sheet ( %s ) column %s : %s", sheetName, info.colName, err.Error())
+		}
+		if len(target) > 0 {
+			refs[j] = target
+		}
+	}
+	return refs, nil
+}
+
+// 引用其他表的单元格, 所有表格加载后检查
+type cellRef struct {
+	row    int
+	col    int
+	target string        // 引用的GameDB field
+	value  reflect.Value // 解析后的值(int,string或其slice)
+}
+
+// 列在结构体中对应的值(不分配内存), 多列字段的元素不存在或为nil时返回false
+func columnValue(structV reflect.Value, info *fieldInfo) (reflect.Value, bool) {
+	v := structV.Field(info.idx)
+	if info.elem >= 0 {
+		if info.elem >= v.Len() {
+			return v, false
+		}
+		v = v.Index(info.elem)
+	}
+	if info.sub >= 0 {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(info.sub)
+	}
+	return v, true
+}
+
+// 检查ref单元格的值在GameDB中存在, 0和空字符串表示不引用
+func (gameDB *GameDB) checkRefs(sheetName string, refs []cellRef) []error {
+	var errs []error
+	keySets := make(map[string]map[interface{}]struct{})
+
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].row != refs[j].row {
+			return refs[i].row < refs[j].row
+		}
+		return refs[i].col < refs[j].col
+	})
+
+	for _, ref := range refs {
+		keys, ok := keySets[ref.target]
+		if !ok {
+			keys = gameDB.refKeys(ref.target)
+			keySets[ref.target] = keys
+		}
+
+		values := []reflect.Value{ref.value}
+		if ref.value.Kind() == reflect.Slice || ref.value.Kind() == reflect.Array {
+			values = values[:0]
+			for i := 0; i < ref.value.Len(); i++ {
+				values = append(values, ref.value.Index(i))
+			}
+		}
+
+		for _, value := range values {
+			key := refKey(value)
+			if key == int64(0) || key == "" {
+				continue
+			}
+			if _, ok := keys[key]; !ok {
+				errs = append(errs, fmt.Errorf("sheet ( %s ), cell (row : %d, col : %d) ref %s : %v not found", sheetName, ref.row, ref.col, ref.target, key))
+			}
+		}
+	}
+	return errs
+}
+
+// GameDB field的所有key: map的key, 或slice元素的Id
+func (gameDB *GameDB) refKeys(target string) map[interface{}]struct{} {
+	keys := make(map[interface{}]struct{})
+	fieldV := reflect.ValueOf(gameDB).Elem().FieldByName(target)
+
+	switch fieldV.Kind() {
+	case reflect.Map:
+		iter := fieldV.MapRange()
+		for iter.Next() {
+			keys[refKey(iter.Key())] = struct{}{}
+		}
+	case reflect.Slice:
+		for i := 0; i < fieldV.Len(); i++ {
+			elemV := reflect.Indirect(fieldV.Index(i))
+			if elemV.Kind() != reflect.Struct {
+				continue
+			}
+			if idV := elemV.FieldByName("Id"); idV.IsValid() {
+				keys[refKey(idV)] = struct{}{}
+			}
+		}
+	}
+	return keys
+}
+
+// 整数统一为int64比较
+func refKey(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.String:
+		return v.String()
+	}
+	return nil
+}
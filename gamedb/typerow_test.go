@@ -0,0 +1,77 @@
+package gamedb
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testRefRow struct {
+	Id      int    `col:"id"`
+	SceneId int    `col:"sceneId"`
+	Others  []int  `col:"others" sep:","`
+	Note    string `col:"note"`
+}
+
+// 加载scene.csv(Scenes), otherData.csv(OtherDatas)和引用它们的ref.csv
+func loadTypeRowSheet(t *testing.T, refCSV string) (*GameDB, error) {
+	t.Helper()
+	dir := writeTestConfig(t, "a")
+	files := map[string]string{
+		"scene.csv": ",ID,地图\n,int,int\n,id,mapId\n,1001,1\n,1002,1\n",
+		"ref.csv":   refCSV,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, "excels", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := &Registry{}
+	registry.register("scene.csv", mapSheet("scene", &Scene{}, "Scenes", "Id"))
+	registry.register("otherData.csv", arraySheet("otherData", &OtherData{}, "OtherDatas"))
+	registry.register("ref.csv", sheetInfo{sheetName: "ref", obj: &testRefRow{}, loader: func(*GameDB, []interface{}) error {
+		return nil
+	}})
+	loader := NewLoader(LoaderOptions{Paths: LoadPaths{Base: dir}, Registry: registry, Cache: CacheOff, Logger: nopLogger{},
+		Scene: SceneOptions{Lazy: true}, // 不加载地图文件
+	})
+	return loader.Load(context.Background())
+}
+
+func TestTypeRow(t *testing.T) {
+	const header = ",ID,场景,其他,备注\n"
+	const title = ",id,sceneId,others,note\n"
+	tests := []struct {
+		name string
+		csv  string
+		err  string // 为空时加载成功
+	}{
+		{"matching type row", header + ",int,int,int[],string\n" + title + ",1,1001,\"1,2\",x\n", ""},
+		{"empty annotations", header + ",int,,,\n" + title + ",1,1001,,x\n", ""},
+		{"mismatched type", header + ",int,string,int[],string\n" + title + ",1,1001,,x\n", "column sceneId : type row says string, field SceneId is int"},
+		{"mismatched depth", header + ",int,int,int[][],string\n" + title + ",1,1001,,x\n", "column others : type row says int[][]"},
+		{"unknown type", header + ",int,int,int[,string\n" + title + ",1,1001,,x\n", `column others : unknown type "int["`},
+		{"no type row", header + ",,,,\n" + title + ",1,9999,9,x\n", ""},
+		{"comment row", ",编号,场景,其他,备注\n,ID,场景,其他,备注\n" + title + ",1,9999,9,x\n", ""},
+		{"good ref", header + ",int,ref:Scenes,ref:OtherDatas,\n" + title + ",1,1001,1,x\n,2,1002,,x\n,3,0,\"1,0\",x\n", ""},
+		{"missing map ref", header + ",int,ref:Scenes,,\n" + title + ",1,1001,,x\n,2,1003,,x\n", "cell (row : 4, col : 2) ref Scenes : 1003 not found"},
+		{"missing slice ref", header + ",int,,ref:OtherDatas,\n" + title + ",1,1001,\"1,2\",x\n", "ref OtherDatas : 2 not found"},
+		{"ref to unknown field", header + ",int,ref:Missing,,\n" + title + ",1,1001,,x\n", "GameDB has no map or slice field Missing"},
+		{"ref from string column", header + ",int,,,ref:Scenes\n" + title + ",1,1001,,x\n", "ref Scenes : x not found"},
+	}
+	for _, test := range tests {
+		gameDB, err := loadTypeRowSheet(t, test.csv)
+		if len(test.err) == 0 {
+			if err != nil || nil == gameDB {
+				t.Errorf("%s : %v", test.name, err)
+			}
+			continue
+		}
+		if nil == err || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s : err %v, want %q", test.name, err, test.err)
+		}
+	}
+}
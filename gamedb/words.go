@@ -0,0 +1,45 @@
+package gamedb
+
+import (
+	"parser/gamelib/censor"
+	"time"
+)
+
+const reportSectionCensor = "censor"
+
+// 敏感词过滤(所有分类),并发安全
+func (gameDB *GameDB) WordFilter() *censor.Filter {
+	return gameDB.words.Library().Filter()
+}
+
+// 按使用场景的策略(e.g : chat, name, guild)检查文本,返回处理方式和命中的分类
+func (gameDB *GameDB) CheckText(policy string, text string) (censor.Verdict, error) {
+	return gameDB.words.Library().Check(policy, text)
+}
+
+// 重新加载敏感词(运营后台触发),失败时继续使用旧词库
+func (gameDB *GameDB) ReloadWords() (censor.ReloadStats, error) {
+	stats, err := gameDB.words.Reload()
+	gameDB.logWordsReload(stats, err)
+	return stats, err
+}
+
+// 定时检查词库文件,变化时自动重新加载. 返回停止函数.
+func (gameDB *GameDB) WatchWords(interval time.Duration) (stop func()) {
+	return gameDB.words.Watch(interval, gameDB.logWordsReload)
+}
+
+// 最近一次加载敏感词的统计
+func (gameDB *GameDB) WordsStats() censor.ReloadStats {
+	return gameDB.words.Stats()
+}
+
+func (gameDB *GameDB) logWordsReload(stats censor.ReloadStats, err error) {
+	if err != nil {
+		gameDB.logf("reload sensitive words err : %s\n", err.Error())
+		gameDB.Report().Add(ReportError, reportSectionCensor, "reload failed : %s", err.Error())
+		return
+	}
+	gameDB.logf("reload sensitive words : %s, added : %v, removed : %v\n", stats, stats.Added, stats.Removed)
+	gameDB.Report().Add(ReportInfo, reportSectionCensor, "reloaded, %s", stats)
+}
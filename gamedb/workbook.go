@@ -0,0 +1,194 @@
+package gamedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 表格文件格式: .xlsx(流式读取), .csv(逗号分隔), .tsv(tab分隔).
+// csv/tsv文件只有一个sheet, 行列约定与xlsx相同(标题在startRow行, 数据从startCol列开始).
+// csv/tsv编码支持UTF-8(可带BOM)和GBK.
+
+// 按行读取sheet, 行号从0开始, 读取结束返回io.EOF.
+// 读到io.EOF或出错时自动释放, 中途放弃读取时需要调用close.
+type rowReader interface {
+	next() (int, []string, error)
+	close() error
+}
+
+// 不同sheet的rows可以并发调用
+type workbook interface {
+	rows(name string) (rowReader, error)
+	close() error
+}
+
+// ctx取消后读取返回ctx.Err()
+func openWorkbook(ctx context.Context, path string) (workbook, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx":
+		book, err := openXlsxStream(ctx, path)
+		if err != nil {
+			return nil, err // 避免返回包含nil指针的接口
+		}
+		return book, nil
+	case ".csv", ".tsv":
+		comma := ','
+		if strings.ToLower(filepath.Ext(path)) == ".tsv" {
+			comma = '\t'
+		}
+		book, err := openCSV(ctx, path, comma)
+		if err != nil {
+			return nil, err
+		}
+		return book, nil
+	}
+	return nil, fmt.Errorf("unsupported excel file ( %s )", path)
+}
+
+// sheet内容: 每个单元格格式化后的文本
+type sheetTable struct {
+	name string
+	rows [][]string // 空行为nil
+	cols int        // 最大列数
+}
+
+// 读取整个sheet
+func readTable(name string, reader rowReader) (*sheetTable, error) {
+	table := &sheetTable{name: name}
+	for {
+		i, row, err := reader.next()
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for len(table.rows) < i {
+			table.rows = append(table.rows, nil)
+		}
+		table.rows = append(table.rows, row)
+		if len(row) > table.cols {
+			table.cols = len(row)
+		}
+	}
+}
+
+type tableReader struct {
+	ctx   context.Context
+	table *sheetTable
+	row   int
+}
+
+func (reader *tableReader) next() (int, []string, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+	for reader.row < len(reader.table.rows) {
+		i := reader.row
+		reader.row++
+		if len(reader.table.rows[i]) > 0 {
+			return i, reader.table.rows[i], nil
+		}
+	}
+	return 0, nil, io.EOF
+}
+
+func (reader *tableReader) close() error {
+	return nil
+}
+
+// csv/tsv文件,整个文件为一个sheet
+type csvWorkbook struct {
+	ctx   context.Context
+	table *sheetTable
+	lock  sync.Mutex
+	used  string // 已读取的sheet名
+}
+
+func openCSV(ctx context.Context, path string, comma rune) (*csvWorkbook, error) {
+	b, err := readFileContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = decodeText(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %w", path, err)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(b))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1 // 每行列数可以不同
+	if comma == '\t' {
+		reader.LazyQuotes = true // tsv一般不使用引号
+	}
+
+	table := &sheetTable{
+		name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+	}
+
+	// csv.Reader会跳过空行,按记录所在行号补回空行,保证行号与xlsx约定一致
+	lastLine := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s : %w", path, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		for lastLine+1 < line {
+			table.rows = append(table.rows, nil)
+			lastLine++
+		}
+		table.rows = append(table.rows, record)
+
+		endLine, _ := reader.FieldPos(len(record) - 1)
+		lastLine = endLine + strings.Count(record[len(record)-1], "\n")
+
+		if len(record) > table.cols {
+			table.cols = len(record)
+		}
+	}
+	return &csvWorkbook{ctx: ctx, table: table}, nil
+}
+
+func (book *csvWorkbook) rows(name string) (rowReader, error) {
+	book.lock.Lock()
+	defer book.lock.Unlock()
+	if len(book.used) > 0 && book.used != name {
+		return nil, fmt.Errorf("csv file ( %s ) has only one sheet, sheet ( %s ) already loaded", book.table.name, book.used)
+	}
+	book.used = name
+	return &tableReader{ctx: book.ctx, table: book.table}, nil
+}
+
+func (book *csvWorkbook) close() error {
+	return nil
+}
+
+// 去除UTF-8 BOM; 非UTF-8文本按GBK解码
+func decodeText(b []byte) ([]byte, error) {
+	if bytes.HasPrefix(b, []byte("\xEF\xBB\xBF")) {
+		return b[3:], nil
+	}
+	if utf8.Valid(b) {
+		return b, nil
+	}
+	decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("neither UTF-8 nor GBK : %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,126 @@
+package gamedb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 写入文件并按表格读取第一个sheet
+func readTestWorkbook(t *testing.T, name string, content []byte) (*sheetTable, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	book, err := openWorkbook(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer book.close()
+	rows, err := book.rows("sheet")
+	if err != nil {
+		return nil, err
+	}
+	return readTable("sheet", rows)
+}
+
+func gbk(t *testing.T, text string) []byte {
+	t.Helper()
+	b, err := simplifiedchinese.GBK.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOpenCSV(t *testing.T) {
+	const header = ",编号,名称\n,,\n,id,name\n"
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		want    string // fmt.Sprintf("%q", rows)
+	}{
+		{"utf-8", "a.csv", []byte(header + ",1,物品\n"),
+			`[["" "编号" "名称"] ["" "" ""] ["" "id" "name"] ["" "1" "物品"]]`},
+		{"utf-8 bom", "a.csv", []byte("\ufeff" + header + ",1,物品\n"),
+			`[["" "编号" "名称"] ["" "" ""] ["" "id" "name"] ["" "1" "物品"]]`},
+		{"gbk", "a.csv", gbk(t, header+",1,物品\n"),
+			`[["" "编号" "名称"] ["" "" ""] ["" "id" "name"] ["" "1" "物品"]]`},
+		{"tsv", "a.tsv", []byte("\t编号\t名称\n\t\t\n\tid\tname\n\t1\ta,\"b\"\n"),
+			`[["" "编号" "名称"] ["" "" ""] ["" "id" "name"] ["" "1" "a,\"b\""]]`},
+		{"gbk tsv", "a.tsv", gbk(t, "\t编号\t名称\n\t\t\n\tid\tname\n"),
+			`[["" "编号" "名称"] ["" "" ""] ["" "id" "name"]]`},
+		// csv.Reader跳过的空行按行号补回
+		{"blank lines", "a.csv", []byte("\n,编号\n\n,id\n\n\n,1\n"),
+			`[[] ["" "编号"] [] ["" "id"] [] [] ["" "1"]]`},
+		{"crlf", "a.csv", []byte(",编号\r\n\r\n,id\r\n,1\r\n"),
+			`[["" "编号"] [] ["" "id"] ["" "1"]]`},
+		// 引号内换行的单元格只占一行, 与xlsx一致
+		{"multiline cell", "a.csv", []byte(",\"a\nb\"\n\n,id\n,1\n"),
+			`[["" "a\nb"] [] ["" "id"] ["" "1"]]`},
+	}
+	for _, test := range tests {
+		table, err := readTestWorkbook(t, test.file, test.content)
+		if err != nil {
+			t.Errorf("%s : %v", test.name, err)
+			continue
+		}
+		if got := fmt.Sprintf("%q", table.rows); got != test.want {
+			t.Errorf("%s : rows %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOpenCSVErrors(t *testing.T) {
+	if _, err := readTestWorkbook(t, "a.csv", []byte(",\"a\n")); nil == err {
+		t.Error("unterminated quote should fail")
+	}
+	if _, err := readTestWorkbook(t, "a.xls", []byte("x")); nil == err {
+		t.Error("unsupported extension should fail")
+	}
+
+	path := filepath.Join(t.TempDir(), "a.csv")
+	if err := ioutil.WriteFile(path, []byte(",id\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	book, err := openWorkbook(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.close()
+	if _, err := book.rows("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := book.rows("a"); err != nil {
+		t.Fatalf("same sheet again : %v", err)
+	}
+	if _, err := book.rows("b"); nil == err {
+		t.Fatal("csv file should have only one sheet")
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"ascii", []byte("id,name"), "id,name"},
+		{"utf-8", []byte("编号"), "编号"},
+		{"bom", []byte("\xEF\xBB\xBF编号"), "编号"},
+		{"bom only", []byte("\xEF\xBB\xBF"), ""},
+		{"gbk", []byte{0xB1, 0xE0, 0xBA, 0xC5}, "编号"},
+	}
+	for _, test := range tests {
+		got, err := decodeText(test.in)
+		if err != nil || string(got) != test.want {
+			t.Errorf("%s : decodeText = %q, %v; want %q", test.name, got, err, test.want)
+		}
+	}
+}
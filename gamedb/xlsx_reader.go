@@ -0,0 +1,472 @@
+package gamedb
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/tealeg/xlsx"
+)
+
+// 流式读取xlsx: 只解压和解析需要的sheet, 逐行返回单元格文本, 不在内存中保留整个工作簿.
+// 多个sheet可以在不同goroutine中同时读取(每个rowReader只能在一个goroutine中使用).
+// 单元格文本与xlsx.Cell.FormattedValue()一致(数字格式仍使用tealeg/xlsx的格式化).
+
+// tealeg/xlsx内置数字格式
+var builtinNumFmt = map[int]string{
+	0:  "general",
+	1:  "0",
+	2:  "0.00",
+	3:  "#,##0",
+	4:  "#,##0.00",
+	9:  "0%",
+	10: "0.00%",
+	11: "0.00e+00",
+	12: "# ?/?",
+	13: "# ??/??",
+	14: "mm-dd-yy",
+	15: "d-mmm-yy",
+	16: "d-mmm",
+	17: "mmm-yy",
+	18: "h:mm am/pm",
+	19: "h:mm:ss am/pm",
+	20: "h:mm",
+	21: "h:mm:ss",
+	22: "m/d/yy h:mm",
+	37: "#,##0 ;(#,##0)",
+	38: "#,##0 ;[red](#,##0)",
+	39: "#,##0.00;(#,##0.00)",
+	40: "#,##0.00;[red](#,##0.00)",
+	41: `_(* #,##0_);_(* \(#,##0\);_(* "-"_);_(@_)`,
+	42: `_("$"* #,##0_);_("$* \(#,##0\);_("$"* "-"_);_(@_)`,
+	43: `_(* #,##0.00_);_(* \(#,##0.00\);_(* "-"??_);_(@_)`,
+	44: `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`,
+	45: "mm:ss",
+	46: "[h]:mm:ss",
+	47: "mmss.0",
+	48: "##0.0e+0",
+	49: "@",
+}
+
+type xlsxStreamWorkbook struct {
+	ctx     context.Context // 读取zip内文件时检查
+	zipFile *zip.ReadCloser
+	files   map[string]*zip.File
+	sheets  map[string]string // sheet名 -> sheet xml路径
+	strings []string          // 共享字符串
+	numFmts []string          // 样式下标 -> 数字格式
+}
+
+func openXlsxStream(ctx context.Context, filePath string) (*xlsxStreamWorkbook, error) {
+	zipFile, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	book := &xlsxStreamWorkbook{
+		ctx:     ctx,
+		zipFile: zipFile,
+		files:   make(map[string]*zip.File),
+		sheets:  make(map[string]string),
+	}
+	for _, f := range zipFile.File {
+		book.files[f.Name] = f
+	}
+
+	if err := book.readWorkbook(); err != nil {
+		zipFile.Close()
+		return nil, fmt.Errorf("%s : %w", filePath, err)
+	}
+	if err := book.readSharedStrings(); err != nil {
+		zipFile.Close()
+		return nil, fmt.Errorf("%s : %w", filePath, err)
+	}
+	if err := book.readStyles(); err != nil {
+		zipFile.Close()
+		return nil, fmt.Errorf("%s : %w", filePath, err)
+	}
+	return book, nil
+}
+
+func (book *xlsxStreamWorkbook) close() error {
+	return book.zipFile.Close()
+}
+
+func (book *xlsxStreamWorkbook) unmarshal(name string, v interface{}) error {
+	f, ok := book.files[name]
+	if !ok {
+		return fmt.Errorf("%s not found", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(contextReader{book.ctx, r}).Decode(v)
+}
+
+// workbook.xml和workbook.xml.rels: sheet名 -> sheet xml路径
+func (book *xlsxStreamWorkbook) readWorkbook() error {
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			Id   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := book.unmarshal("xl/workbook.xml", &workbook); err != nil {
+		return err
+	}
+
+	var rels struct {
+		Relationships []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := book.unmarshal("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return err
+	}
+
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.Id] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.Id] = path.Join("xl", rel.Target)
+		}
+	}
+	for _, sheet := range workbook.Sheets {
+		book.sheets[sheet.Name] = targets[sheet.Id]
+	}
+	return nil
+}
+
+// 逐个读取共享字符串,富文本拼接各段文本
+func (book *xlsxStreamWorkbook) readSharedStrings() error {
+	f, ok := book.files["xl/sharedStrings.xml"]
+	if !ok {
+		return nil // 没有字符串单元格
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	decoder := xml.NewDecoder(contextReader{book.ctx, r})
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "sst" {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "uniqueCount" {
+					if count, err := strconv.Atoi(attr.Value); err == nil {
+						book.strings = make([]string, 0, count)
+					}
+				}
+			}
+			continue
+		}
+		if start.Name.Local != "si" {
+			continue
+		}
+
+		var si richText
+		if err := decoder.DecodeElement(&si, &start); err != nil {
+			return err
+		}
+		book.strings = append(book.strings, si.text())
+	}
+}
+
+type richText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rich *richText) text() string {
+	if len(rich.R) == 0 {
+		return rich.T
+	}
+	var b strings.Builder
+	for _, r := range rich.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// styles.xml: 单元格样式下标 -> 数字格式
+func (book *xlsxStreamWorkbook) readStyles() error {
+	if _, ok := book.files["xl/styles.xml"]; !ok {
+		return nil
+	}
+
+	var styles struct {
+		NumFmts []struct {
+			Id   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtId int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := book.unmarshal("xl/styles.xml", &styles); err != nil {
+		return err
+	}
+
+	custom := make(map[int]string)
+	for _, numFmt := range styles.NumFmts {
+		custom[numFmt.Id] = numFmt.Code
+	}
+	book.numFmts = make([]string, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		if builtin, ok := builtinNumFmt[xf.NumFmtId]; ok {
+			book.numFmts[i] = builtin
+		} else {
+			book.numFmts[i] = custom[xf.NumFmtId]
+		}
+	}
+	return nil
+}
+
+func (book *xlsxStreamWorkbook) rows(name string) (rowReader, error) {
+	sheetPath, ok := book.sheets[name]
+	if !ok {
+		return nil, fmt.Errorf("no sheet ( %s ) found", name)
+	}
+	f, ok := book.files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("sheet ( %s ) file %s not found", name, sheetPath)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxRowReader{
+		book:    book,
+		name:    name,
+		r:       r,
+		decoder: xml.NewDecoder(contextReader{book.ctx, r}),
+		row:     -1,
+		cells:   make(map[string]*xlsx.Cell),
+	}, nil
+}
+
+type xlsxCell struct {
+	R  string    `xml:"r,attr"`
+	S  int       `xml:"s,attr"`
+	T  string    `xml:"t,attr"`
+	V  string    `xml:"v"`
+	Is *richText `xml:"is"`
+}
+
+type xlsxRowReader struct {
+	book    *xlsxStreamWorkbook
+	name    string
+	r       io.ReadCloser
+	decoder *xml.Decoder
+	row     int                   // 上一行的行号
+	cells   map[string]*xlsx.Cell // 数字格式 -> 用于格式化的Cell
+}
+
+// 读取下一行, 行号从0开始(跳过xml中不存在的行), 结束时返回io.EOF
+func (reader *xlsxRowReader) next() (int, []string, error) {
+	if nil == reader.decoder {
+		return 0, nil, io.EOF
+	}
+
+	for {
+		token, err := reader.decoder.Token()
+		if err != nil {
+			reader.close()
+			if err == io.EOF {
+				return 0, nil, io.EOF
+			}
+			return 0, nil, fmt.Errorf("sheet ( %s ) : %w", reader.name, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		reader.row++
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "r" {
+				if r, err := strconv.Atoi(attr.Value); err == nil {
+					reader.row = r - 1
+				}
+			}
+		}
+
+		cells, err := reader.readRow()
+		if err != nil {
+			reader.close()
+			return 0, nil, fmt.Errorf("sheet ( %s ), row %d : %w", reader.name, reader.row+1, err)
+		}
+		return reader.row, cells, nil
+	}
+}
+
+// 关闭sheet的zip条目, 可以重复调用
+func (reader *xlsxRowReader) close() error {
+	if nil == reader.decoder {
+		return nil
+	}
+	reader.decoder = nil
+	return reader.r.Close()
+}
+
+// 读取<row>内的所有<c>, 按列号放入对应位置
+func (reader *xlsxRowReader) readRow() ([]string, error) {
+	var cells []string
+	col := -1
+	for {
+		token, err := reader.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				return cells, nil
+			}
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+
+			var cell xlsxCell
+			if err := reader.decoder.DecodeElement(&cell, &t); err != nil {
+				return nil, err
+			}
+
+			col++
+			if len(cell.R) > 0 {
+				if col, err = columnIndex(cell.R); err != nil {
+					return nil, err
+				}
+			}
+
+			text, err := reader.cellText(&cell)
+			if err != nil {
+				return nil, fmt.Errorf("cell %s fomatted err : %s", cell.R, err.Error())
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = text
+		}
+	}
+}
+
+// 与tealeg/xlsx相同的单元格取值和格式化
+func (reader *xlsxRowReader) cellText(cell *xlsxCell) (string, error) {
+	numFmt := builtinNumFmt[0]
+	if cell.S >= 0 && cell.S < len(reader.book.numFmts) {
+		numFmt = reader.book.numFmts[cell.S]
+	}
+
+	value := strings.Trim(cell.V, " \t\n\r")
+	switch cell.T {
+	case "s":
+		if len(value) == 0 {
+			return reader.formatString("", numFmt)
+		}
+		idx, err := strconv.Atoi(value)
+		if err != nil || idx < 0 || idx >= len(reader.book.strings) {
+			return "", fmt.Errorf("invalid shared string index %s", value)
+		}
+		return reader.formatString(reader.book.strings[idx], numFmt)
+	case "inlineStr":
+		if nil == cell.Is {
+			return reader.formatString("", numFmt)
+		}
+		if len(cell.Is.T) > 0 {
+			return reader.formatString(strings.Trim(cell.Is.T, " \t\n\r"), numFmt)
+		}
+		return reader.formatString(cell.Is.text(), numFmt)
+	case "str":
+		return reader.formatString(value, numFmt)
+	case "b":
+		switch value {
+		case "0":
+			return "FALSE", nil
+		case "1":
+			return "TRUE", nil
+		}
+		return value, fmt.Errorf("invalid value in bool cell")
+	case "e", "d":
+		return value, nil
+	case "", "n":
+		if len(value) == 0 {
+			return "", nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return value, err
+		}
+		formatter := reader.formatter(numFmt)
+		formatter.SetFloatWithFormat(f, numFmt)
+		return formatter.FormattedValue()
+	}
+	return "", fmt.Errorf("invalid cell type %s", cell.T)
+}
+
+func (reader *xlsxRowReader) formatString(value string, numFmt string) (string, error) {
+	if numFmt == builtinNumFmt[0] {
+		return value, nil
+	}
+	formatter := reader.formatter(numFmt)
+	formatter.SetString(value)
+	formatter.SetFormat(numFmt)
+	return formatter.FormattedValue()
+}
+
+// 每种数字格式复用一个xlsx.Cell,避免重复解析格式
+func (reader *xlsxRowReader) formatter(numFmt string) *xlsx.Cell {
+	cell, ok := reader.cells[numFmt]
+	if !ok {
+		cell = &xlsx.Cell{}
+		reader.cells[numFmt] = cell
+	}
+	return cell
+}
+
+// "AB12" -> 27
+func columnIndex(ref string) (int, error) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("invalid cell reference %s", ref)
+	}
+	return col - 1, nil
+}
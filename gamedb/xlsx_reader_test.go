@@ -0,0 +1,302 @@
+package gamedb
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tealeg/xlsx"
+)
+
+const testXlsxNs = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"`
+
+// 共享字符串: 普通文本, 富文本, 需要保留的空格, 空字符串
+const testSharedStrings = `<sst ` + testXlsxNs + ` count="4" uniqueCount="4">` +
+	`<si><t>名称</t></si>` +
+	`<si><r><t>rich</t></r><r><t xml:space="preserve"> text</t></r></si>` +
+	`<si><t xml:space="preserve"> padded </t></si>` +
+	`<si><t></t></si>` +
+	`</sst>`
+
+// 样式下标: 0 general, 1 mm-dd-yy, 2 h:mm:ss, 3 自定义日期时间, 4 m/d/yy h:mm, 5 #,##0.00, 6 0.00%, 7 @
+const testStyles = `<styleSheet ` + testXlsxNs + `>` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<cellXfs count="8">` +
+	`<xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="21"/><xf numFmtId="164"/>` +
+	`<xf numFmtId="22"/><xf numFmtId="4"/><xf numFmtId="10"/><xf numFmtId="49"/>` +
+	`</cellXfs></styleSheet>`
+
+// 写入xlsx文件, sheets为sheet名 -> <sheetData>内容, 按名称顺序排列
+func writeTestXlsx(t *testing.T, names []string, sheets map[string]string) string {
+	t.Helper()
+	var workbook, rels, types strings.Builder
+	files := make(map[string]string)
+	for i, name := range names {
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name, i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		files[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)] = `<worksheet ` + testXlsxNs + `><sheetData>` + sheets[name] + `</sheetData></worksheet>`
+	}
+	files["[Content_Types].xml"] = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		types.String() + `</Types>`
+	files["_rels/.rels"] = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	files["xl/workbook.xml"] = `<workbook ` + testXlsxNs + ` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets>` + workbook.String() + `</sheets></workbook>`
+	files["xl/_rels/workbook.xml.rels"] = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		rels.String() +
+		`<Relationship Id="rIdS" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>` +
+		`<Relationship Id="rIdT" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+	files["xl/sharedStrings.xml"] = testSharedStrings
+	files["xl/styles.xml"] = testStyles
+
+	filePath := filepath.Join(t.TempDir(), "test.xlsx")
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// 去除行尾空单元格和末尾空行, 两种读取方式补齐空位的规则不同
+func trimTable(rows [][]string) [][]string {
+	for i, row := range rows {
+		for len(row) > 0 && len(row[len(row)-1]) == 0 {
+			row = row[:len(row)-1]
+		}
+		rows[i] = row
+	}
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows
+}
+
+func readTealegTable(t *testing.T, filePath string, sheetName string) [][]string {
+	t.Helper()
+	file, err := xlsx.OpenFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet, ok := file.Sheet[sheetName]
+	if !ok {
+		t.Fatalf("tealeg : no sheet %s", sheetName)
+	}
+	rows := make([][]string, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		if nil == row {
+			continue
+		}
+		for _, cell := range row.Cells {
+			text, err := cell.FormattedValue()
+			if err != nil {
+				t.Fatalf("tealeg row %d : %v", i+1, err)
+			}
+			rows[i] = append(rows[i], text)
+		}
+	}
+	return trimTable(rows)
+}
+
+func readStreamTable(t *testing.T, filePath string, sheetName string) [][]string {
+	t.Helper()
+	book, err := openXlsxStream(context.Background(), filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.close()
+	rows, err := book.rows(sheetName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := readTable(sheetName, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trimTable(table.rows)
+}
+
+func TestXlsxStreamMatchesTealeg(t *testing.T) {
+	sheets := map[string]string{
+		"strings": `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c></row>` +
+			`<row r="2"><c r="A2" t="inlineStr"><is><t>内联</t></is></c><c r="B2" t="inlineStr"><is><r><t>a</t></r><r><t>b</t></r></is></c>` +
+			`<c r="C2" t="inlineStr"><is><t> trimmed </t></is></c><c r="D2" t="str"><v>formula</v></c><c r="E2" t="s" s="7"><v>0</v></c></row>`,
+		"bools": `<row r="1"><c r="A1" t="b"><v>1</v></c><c r="B1" t="b"><v>0</v></c><c r="C1" t="e"><v>#N/A</v></c></row>`,
+		"dates": `<row r="1"><c r="A1" s="1"><v>43831</v></c><c r="B1" s="2"><v>0.5</v></c><c r="C1" s="2"><v>0.75001</v></c>` +
+			`<c r="D1" s="3"><v>43831.75</v></c><c r="E1" s="4"><v>44000.25</v></c></row>`,
+		"floats": `<row r="1"><c r="A1"><v>0.1</v></c><c r="B1"><v>1.5E-7</v></c><c r="C1"><v>123456789012</v></c>` +
+			`<c r="D1"><v>3.0000000000000004</v></c><c r="E1"><v>-2</v></c><c r="F1"><v>100</v></c><c r="G1"><v>1e-10</v></c></row>` +
+			`<row r="2"><c r="A2" s="5"><v>1234.5</v></c><c r="B2" s="6"><v>0.25</v></c><c r="C2" s="7"><v>12</v></c><c r="D2"><v></v></c></row>`,
+		"sparse": `<row r="2"><c r="B2"><v>1</v></c><c r="E2"><v>2</v></c></row>` +
+			`<row r="5"><c r="A5" t="s"><v>0</v></c><c r="AA5"><v>3</v></c></row>` +
+			`<row r="6"><c r="C6" t="inlineStr"><is><t>x</t></is></c></row>`,
+		"trailing": `<row r="1"><c r="A1"><v>1</v></c></row>` +
+			`<row r="2"><c r="A2"><v>2</v></c></row>` +
+			`<row r="3"/><row r="4"><c r="A4"/></row><row r="5"><c r="B5" t="s"><v>3</v></c></row>`,
+	}
+	names := []string{"strings", "bools", "dates", "floats", "sparse", "trailing"}
+	filePath := writeTestXlsx(t, names, sheets)
+
+	for _, name := range names {
+		want := readTealegTable(t, filePath, name)
+		got := readStreamTable(t, filePath, name)
+		if len(want) == 0 {
+			t.Fatalf("sheet %s : tealeg read no rows", name)
+		}
+		if len(got) != len(want) {
+			t.Errorf("sheet %s : %d rows %q, tealeg %d rows %q", name, len(got), got, len(want), want)
+			continue
+		}
+		for i := range want {
+			if len(got[i]) != len(want[i]) {
+				t.Errorf("sheet %s row %d : %q, tealeg %q", name, i+1, got[i], want[i])
+				continue
+			}
+			for j := range want[i] {
+				if got[i][j] != want[i][j] {
+					t.Errorf("sheet %s cell (%d, %d) : %q, tealeg %q", name, i+1, j+1, got[i][j], want[i][j])
+				}
+			}
+		}
+	}
+}
+
+// 行号取自r属性, 没有数据的行不返回
+func TestXlsxStreamRowNumbers(t *testing.T) {
+	filePath := writeTestXlsx(t, []string{"sheet"}, map[string]string{
+		"sheet": `<row r="2"><c r="B2"><v>1</v></c></row><row r="5"><c r="C5"><v>2</v></c></row><row><c r="A6"><v>3</v></c></row>`,
+	})
+	book, err := openXlsxStream(context.Background(), filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.close()
+	rows, err := book.rows("sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for {
+		i, row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d:%q", i, row))
+	}
+	if want := `[1:["" "1"] 4:["" "" "2"] 5:["3"]]`; fmt.Sprint(got) != want {
+		t.Fatalf("rows %s, want %s", got, want)
+	}
+	if _, err := book.rows("missing"); nil == err {
+		t.Fatal("missing sheet should fail")
+	}
+}
+
+type countCloser struct {
+	io.ReadCloser
+	closed int
+}
+
+func (closer *countCloser) Close() error {
+	closer.closed++
+	return closer.ReadCloser.Close()
+}
+
+// 中途放弃, 出错或取消时都关闭sheet的zip条目, 且只关闭一次
+func TestXlsxStreamClosesRows(t *testing.T) {
+	var data strings.Builder
+	for i := 1; i <= 2000; i++ {
+		fmt.Fprintf(&data, `<row r="%d"><c r="A%d"><v>%d</v></c></row>`, i, i, i)
+	}
+	filePath := writeTestXlsx(t, []string{"big", "bad"}, map[string]string{
+		"big": data.String(),
+		"bad": `<row r="1"><c r="A1"><v>1</v></c></row><row r="2"><c r="A2" t="s"><v>99</v></c></row>`,
+	})
+
+	open := func(ctx context.Context, name string) (*xlsxRowReader, *countCloser) {
+		t.Helper()
+		book, err := openXlsxStream(ctx, filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { book.close() })
+		rows, err := book.rows(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := rows.(*xlsxRowReader)
+		closer := &countCloser{ReadCloser: reader.r}
+		reader.r = closer
+		return reader, closer
+	}
+
+	// 中途放弃
+	reader, closer := open(context.Background(), "big")
+	if _, _, err := reader.next(); err != nil {
+		t.Fatal(err)
+	}
+	reader.close()
+	reader.close()
+	if closer.closed != 1 {
+		t.Fatalf("abandoned rows closed %d times", closer.closed)
+	}
+	if _, _, err := reader.next(); err != io.EOF {
+		t.Fatalf("next after close : %v", err)
+	}
+
+	// 单元格出错
+	reader, closer = open(context.Background(), "bad")
+	var err error
+	for err == nil {
+		_, _, err = reader.next()
+	}
+	if err == io.EOF || closer.closed != 1 {
+		t.Fatalf("bad cell : err %v, closed %d times", err, closer.closed)
+	}
+	reader.close()
+	if closer.closed != 1 {
+		t.Fatalf("close after error closed %d times", closer.closed)
+	}
+
+	// 取消
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, closer = open(ctx, "big")
+	if _, _, err := reader.next(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for err = nil; err == nil; {
+		_, _, err = reader.next()
+	}
+	if !errors.Is(err, context.Canceled) || closer.closed != 1 {
+		t.Fatalf("canceled : err %v, closed %d times", err, closer.closed)
+	}
+}
@@ -0,0 +1,322 @@
+package aoi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 九宫格AOI(Area Of Interest),坐标为场景格子坐标(gamedb.SceneMap的x,y).
+// 场景格子按towerSize*towerSize划分为灯塔(tower),实体可见范围为所在灯塔及周围8个灯塔.
+// 每个场景实例持有自己的Grid; 回调在释放锁之后触发,回调中可以再次操作Grid.
+// 事件按产生的顺序逐个回调,同一时刻只有一个回调在执行: 其他goroutine或回调中产生的事件进入队列,
+// 由正在触发的调用依次触发, 因此Insert/Move/Remove返回时其事件可能尚未回调.
+
+type EntityId int64
+
+// watcher看到target进入/离开视野
+type EventFunc func(watcher EntityId, target EntityId)
+
+type entity struct {
+	x     int
+	y     int
+	tower int
+}
+
+type event struct {
+	enter   bool
+	watcher EntityId
+	target  EntityId
+}
+
+type Grid struct {
+	lock      sync.Mutex
+	width     int // 场景宽(格子数)
+	height    int // 场景高(格子数)
+	towerSize int
+	towersX   int
+	towersY   int
+	towers    []map[EntityId]struct{}
+	entities  map[EntityId]*entity
+	onEnter   EventFunc
+	onLeave   EventFunc
+	events    []event // 待触发的事件队列
+	spare     []event // 已触发的事件缓存,复用内存
+	firing    bool    // 有调用正在触发事件
+}
+
+// width,height为场景格子数(e.g : sceneMap.Width, sceneMap.Height)
+func NewGrid(width, height, towerSize int) *Grid {
+	if towerSize < 1 {
+		towerSize = 1
+	}
+	towersX := (width + towerSize - 1) / towerSize
+	towersY := (height + towerSize - 1) / towerSize
+	return &Grid{
+		width:     width,
+		height:    height,
+		towerSize: towerSize,
+		towersX:   towersX,
+		towersY:   towersY,
+		towers:    make([]map[EntityId]struct{}, towersX*towersY),
+		entities:  make(map[EntityId]*entity),
+	}
+}
+
+// 设置进入/离开视野回调,nil表示不关心
+func (grid *Grid) SetCallbacks(onEnter, onLeave EventFunc) {
+	grid.lock.Lock()
+	defer grid.lock.Unlock()
+	grid.onEnter = onEnter
+	grid.onLeave = onLeave
+}
+
+func (grid *Grid) inBounds(x, y int) bool {
+	return x >= 0 && y >= 0 && x < grid.width && y < grid.height
+}
+
+func (grid *Grid) towerOf(x, y int) int {
+	return (y/grid.towerSize)*grid.towersX + x/grid.towerSize
+}
+
+// 灯塔及周围8个灯塔是否相邻(含自身)
+func (grid *Grid) towerNear(a, b int) bool {
+	ax, ay := a%grid.towersX, a/grid.towersX
+	bx, by := b%grid.towersX, b/grid.towersX
+	return ax-bx <= 1 && bx-ax <= 1 && ay-by <= 1 && by-ay <= 1
+}
+
+// 遍历灯塔周围(含自身)的灯塔
+func (grid *Grid) eachNearTower(tower int, fn func(int)) {
+	tx, ty := tower%grid.towersX, tower/grid.towersX
+	for y := ty - 1; y <= ty+1; y++ {
+		if y < 0 || y >= grid.towersY {
+			continue
+		}
+		for x := tx - 1; x <= tx+1; x++ {
+			if x < 0 || x >= grid.towersX {
+				continue
+			}
+			fn(y*grid.towersX + x)
+		}
+	}
+}
+
+// 实体与灯塔内其他实体互相产生进入/离开事件
+func (grid *Grid) addEvents(id EntityId, tower int, enter bool) {
+	for other := range grid.towers[tower] {
+		if other == id {
+			continue
+		}
+		grid.events = append(grid.events, event{enter, other, id}, event{enter, id, other})
+	}
+}
+
+// 释放锁并按顺序触发事件, 已有调用在触发时只把事件留在队列中
+func (grid *Grid) unlockAndFire() {
+	if grid.firing || len(grid.events) == 0 {
+		grid.lock.Unlock()
+		return
+	}
+	grid.firing = true
+	completed := false
+	defer func() {
+		// 回调panic时放弃剩余事件,避免后续事件永远无法触发
+		if !completed {
+			grid.lock.Lock()
+			grid.events = grid.events[:0]
+			grid.firing = false
+			grid.lock.Unlock()
+		}
+	}()
+
+	for len(grid.events) > 0 {
+		events := grid.events
+		onEnter, onLeave := grid.onEnter, grid.onLeave
+		grid.events = grid.spare[:0] // 回调中产生的事件追加到新队列
+		grid.lock.Unlock()
+
+		for _, e := range events {
+			if e.enter && onEnter != nil {
+				onEnter(e.watcher, e.target)
+			} else if !e.enter && onLeave != nil {
+				onLeave(e.watcher, e.target)
+			}
+		}
+
+		grid.lock.Lock()
+		grid.spare = events[:0]
+	}
+	grid.firing = false
+	completed = true
+	grid.lock.Unlock()
+}
+
+// 加入实体
+func (grid *Grid) Insert(id EntityId, x, y int) error {
+	grid.lock.Lock()
+	if _, ok := grid.entities[id]; ok {
+		grid.lock.Unlock()
+		return fmt.Errorf("aoi entity %d already exists", id)
+	}
+	if !grid.inBounds(x, y) {
+		grid.lock.Unlock()
+		return fmt.Errorf("aoi entity %d position (%d, %d) out of range", id, x, y)
+	}
+
+	tower := grid.towerOf(x, y)
+	grid.eachNearTower(tower, func(t int) {
+		grid.addEvents(id, t, true)
+	})
+
+	grid.entities[id] = &entity{x: x, y: y, tower: tower}
+	if nil == grid.towers[tower] {
+		grid.towers[tower] = make(map[EntityId]struct{})
+	}
+	grid.towers[tower][id] = struct{}{}
+
+	grid.unlockAndFire()
+	return nil
+}
+
+// 移动实体,跨灯塔时产生进入/离开事件
+func (grid *Grid) Move(id EntityId, x, y int) error {
+	grid.lock.Lock()
+	e, ok := grid.entities[id]
+	if !ok {
+		grid.lock.Unlock()
+		return fmt.Errorf("aoi entity %d not found", id)
+	}
+	if !grid.inBounds(x, y) {
+		grid.lock.Unlock()
+		return fmt.Errorf("aoi entity %d position (%d, %d) out of range", id, x, y)
+	}
+
+	oldTower, newTower := e.tower, grid.towerOf(x, y)
+	e.x, e.y = x, y
+	if oldTower == newTower {
+		grid.lock.Unlock()
+		return nil
+	}
+
+	delete(grid.towers[oldTower], id)
+	grid.eachNearTower(oldTower, func(t int) {
+		if !grid.towerNear(t, newTower) {
+			grid.addEvents(id, t, false)
+		}
+	})
+	grid.eachNearTower(newTower, func(t int) {
+		if !grid.towerNear(t, oldTower) {
+			grid.addEvents(id, t, true)
+		}
+	})
+
+	e.tower = newTower
+	if nil == grid.towers[newTower] {
+		grid.towers[newTower] = make(map[EntityId]struct{})
+	}
+	grid.towers[newTower][id] = struct{}{}
+
+	grid.unlockAndFire()
+	return nil
+}
+
+// 移除实体,周围实体收到离开事件
+func (grid *Grid) Remove(id EntityId) error {
+	grid.lock.Lock()
+	e, ok := grid.entities[id]
+	if !ok {
+		grid.lock.Unlock()
+		return fmt.Errorf("aoi entity %d not found", id)
+	}
+
+	delete(grid.entities, id)
+	delete(grid.towers[e.tower], id)
+	grid.eachNearTower(e.tower, func(t int) {
+		grid.addEvents(id, t, false)
+	})
+
+	grid.unlockAndFire()
+	return nil
+}
+
+// 实体位置
+func (grid *Grid) Position(id EntityId) (int, int, bool) {
+	grid.lock.Lock()
+	defer grid.lock.Unlock()
+	if e, ok := grid.entities[id]; ok {
+		return e.x, e.y, true
+	}
+	return 0, 0, false
+}
+
+func (grid *Grid) Count() int {
+	grid.lock.Lock()
+	defer grid.lock.Unlock()
+	return len(grid.entities)
+}
+
+// 实体九宫格内的其他实体,结果追加到dst
+func (grid *Grid) NineGrid(dst []EntityId, id EntityId) []EntityId {
+	grid.lock.Lock()
+	defer grid.lock.Unlock()
+
+	e, ok := grid.entities[id]
+	if !ok {
+		return dst
+	}
+	grid.eachNearTower(e.tower, func(t int) {
+		for other := range grid.towers[t] {
+			if other != id {
+				dst = append(dst, other)
+			}
+		}
+	})
+	return dst
+}
+
+// 格子(x,y)所在九宫格内的实体,结果追加到dst
+func (grid *Grid) NineGridAt(dst []EntityId, x, y int) []EntityId {
+	grid.lock.Lock()
+	defer grid.lock.Unlock()
+
+	if !grid.inBounds(x, y) {
+		return dst
+	}
+	grid.eachNearTower(grid.towerOf(x, y), func(t int) {
+		for other := range grid.towers[t] {
+			dst = append(dst, other)
+		}
+	})
+	return dst
+}
+
+// 以(x,y)为圆心,radius格为半径范围内的实体,结果追加到dst
+func (grid *Grid) Range(dst []EntityId, x, y, radius int) []EntityId {
+	grid.lock.Lock()
+	defer grid.lock.Unlock()
+
+	minTX, maxTX := clamp((x-radius)/grid.towerSize, grid.towersX), clamp((x+radius)/grid.towerSize, grid.towersX)
+	minTY, maxTY := clamp((y-radius)/grid.towerSize, grid.towersY), clamp((y+radius)/grid.towerSize, grid.towersY)
+	for ty := minTY; ty <= maxTY; ty++ {
+		for tx := minTX; tx <= maxTX; tx++ {
+			for id := range grid.towers[ty*grid.towersX+tx] {
+				e := grid.entities[id]
+				dx, dy := e.x-x, e.y-y
+				if dx*dx+dy*dy <= radius*radius {
+					dst = append(dst, id)
+				}
+			}
+		}
+	}
+	return dst
+}
+
+func clamp(v, n int) int {
+	if v < 0 {
+		return 0
+	}
+	if v >= n {
+		return n - 1
+	}
+	return v
+}
@@ -0,0 +1,312 @@
+package aoi
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 记录回调并维护每个实体看到的实体集合, 进入已可见或离开不可见的实体时报错
+type recorder struct {
+	log     []string
+	visible map[EntityId]map[EntityId]bool
+	errs    []string
+}
+
+func newRecorder(grid *Grid) *recorder {
+	rec := &recorder{visible: make(map[EntityId]map[EntityId]bool)}
+	grid.SetCallbacks(func(watcher, target EntityId) {
+		rec.log = append(rec.log, fmt.Sprintf("%d+%d", watcher, target))
+		if nil == rec.visible[watcher] {
+			rec.visible[watcher] = make(map[EntityId]bool)
+		}
+		if rec.visible[watcher][target] {
+			rec.errs = append(rec.errs, fmt.Sprintf("%d enters %d twice", target, watcher))
+		}
+		rec.visible[watcher][target] = true
+	}, func(watcher, target EntityId) {
+		rec.log = append(rec.log, fmt.Sprintf("%d-%d", watcher, target))
+		if !rec.visible[watcher][target] {
+			rec.errs = append(rec.errs, fmt.Sprintf("%d leaves %d without entering", target, watcher))
+		}
+		delete(rec.visible[watcher], target)
+	})
+	return rec
+}
+
+// 取出并排序本次操作的事件
+func (rec *recorder) take() []string {
+	log := rec.log
+	rec.log = nil
+	sort.Strings(log)
+	return log
+}
+
+// 每个实体看到的集合与九宫格一致
+func (rec *recorder) check(t *testing.T, grid *Grid, ids map[EntityId]bool) {
+	t.Helper()
+	if len(rec.errs) > 0 {
+		t.Fatal(rec.errs)
+	}
+	for id := range ids {
+		near := grid.NineGrid(nil, id)
+		if len(near) != len(rec.visible[id]) {
+			t.Fatalf("entity %d : nine grid %v, visible %v", id, near, rec.visible[id])
+		}
+		for _, other := range near {
+			if !rec.visible[id][other] {
+				t.Fatalf("entity %d : %d in nine grid but not visible", id, other)
+			}
+		}
+	}
+}
+
+func TestNineGridEvents(t *testing.T) {
+	// 3x3个灯塔
+	grid := NewGrid(30, 30, 10)
+	rec := newRecorder(grid)
+	steps := []struct {
+		name string
+		op   func() error
+		want []string
+	}{
+		{"insert 1 at tower 0", func() error { return grid.Insert(1, 0, 0) }, nil},
+		{"insert 2 at tower 8", func() error { return grid.Insert(2, 25, 25) }, nil},
+		{"insert 3 at tower 4", func() error { return grid.Insert(3, 15, 15) }, []string{"1+3", "2+3", "3+1", "3+2"}},
+		{"move 1 inside tower 0", func() error { return grid.Move(1, 9, 9) }, nil},
+		{"move 1 to tower 2", func() error { return grid.Move(1, 29, 0) }, nil},
+		{"move 2 to tower 5", func() error { return grid.Move(2, 29, 15) }, []string{"1+2", "2+1"}},
+		{"move 2 to tower 6", func() error { return grid.Move(2, 0, 29) }, []string{"1-2", "2-1"}},
+		{"remove 3", func() error { return grid.Remove(3) }, []string{"1-3", "2-3", "3-1", "3-2"}},
+	}
+	for _, step := range steps {
+		if err := step.op(); err != nil {
+			t.Fatalf("%s : %v", step.name, err)
+		}
+		got := rec.take()
+		if fmt.Sprint(got) != fmt.Sprint(step.want) {
+			t.Fatalf("%s : events %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if err := grid.Insert(1, 0, 0); nil == err {
+		t.Fatal("insert existing entity should fail")
+	}
+	if err := grid.Move(1, 30, 0); nil == err {
+		t.Fatal("move out of range should fail")
+	}
+	if err := grid.Remove(3); nil == err {
+		t.Fatal("remove missing entity should fail")
+	}
+}
+
+func TestNineGridMatchesEvents(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	grid := NewGrid(100, 80, 7)
+	rec := newRecorder(grid)
+	alive := make(map[EntityId]bool)
+	for i := 0; i < 5000; i++ {
+		id := EntityId(r.Intn(40))
+		switch {
+		case !alive[id]:
+			if err := grid.Insert(id, r.Intn(100), r.Intn(80)); err != nil {
+				t.Fatal(err)
+			}
+			alive[id] = true
+		case r.Intn(10) == 0:
+			if err := grid.Remove(id); err != nil {
+				t.Fatal(err)
+			}
+			delete(alive, id)
+			delete(rec.visible, id)
+		default:
+			x, y, _ := grid.Position(id)
+			x, y = clamp(x+r.Intn(21)-10, 100), clamp(y+r.Intn(21)-10, 80)
+			if err := grid.Move(id, x, y); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rec.check(t, grid, alive)
+	}
+}
+
+// 回调中操作Grid产生的事件在当前事件之后触发
+func TestReentrantEventsKeepOrder(t *testing.T) {
+	grid := NewGrid(30, 30, 10)
+	var log []string
+	moved := false
+	grid.SetCallbacks(func(watcher, target EntityId) {
+		log = append(log, fmt.Sprintf("%d+%d", watcher, target))
+		if !moved {
+			moved = true
+			if err := grid.Move(2, 29, 29); err != nil {
+				t.Error(err)
+			}
+		}
+	}, func(watcher, target EntityId) {
+		log = append(log, fmt.Sprintf("%d-%d", watcher, target))
+	})
+
+	if err := grid.Insert(1, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := grid.Insert(2, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 4 {
+		t.Fatalf("events %v, want 4", log)
+	}
+	enters, leaves := append([]string(nil), log[:2]...), append([]string(nil), log[2:]...)
+	sort.Strings(enters)
+	sort.Strings(leaves)
+	if got := fmt.Sprint(enters, leaves); got != "[1+2 2+1] [1-2 2-1]" {
+		t.Fatalf("events %v, want enters before leaves", log)
+	}
+}
+
+// 多个goroutine同时操作时回调不并发执行, 每对实体的进入和离开交替出现
+func TestConcurrentEventsKeepOrder(t *testing.T) {
+	grid := NewGrid(60, 60, 5)
+	rec := newRecorder(grid)
+	const workers = 8
+	ids := make(map[EntityId]bool)
+	for i := 0; i < workers; i++ {
+		ids[EntityId(i)] = true
+		if err := grid.Insert(EntityId(i), 30, 30); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id EntityId) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(id)))
+			for j := 0; j < 2000; j++ {
+				if err := grid.Move(id, r.Intn(60), r.Intn(60)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(EntityId(i))
+	}
+	wg.Wait()
+
+	grid.lock.Lock()
+	pending := grid.firing || len(grid.events) > 0
+	grid.lock.Unlock()
+	if pending {
+		t.Fatal("events left in queue")
+	}
+	rec.check(t, grid, ids)
+}
+
+// 并发Insert/Move/Remove, 回调中检查没有其他回调同时执行
+func TestConcurrentCallbacksNotReentered(t *testing.T) {
+	grid := NewGrid(40, 40, 4)
+	var running, overlaps, events int32
+	callback := func(watcher, target EntityId) {
+		if !atomic.CompareAndSwapInt32(&running, 0, 1) {
+			atomic.AddInt32(&overlaps, 1)
+			return
+		}
+		atomic.AddInt32(&events, 1)
+		atomic.StoreInt32(&running, 0)
+	}
+	grid.SetCallbacks(callback, callback)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(worker)))
+			for j := 0; j < 500; j++ {
+				id := EntityId(worker*1000 + j%10)
+				if _, _, ok := grid.Position(id); !ok {
+					if err := grid.Insert(id, r.Intn(40), r.Intn(40)); err != nil {
+						t.Error(err)
+						return
+					}
+					continue
+				}
+				if r.Intn(8) == 0 {
+					if err := grid.Remove(id); err != nil {
+						t.Error(err)
+						return
+					}
+					continue
+				}
+				if err := grid.Move(id, r.Intn(40), r.Intn(40)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if overlaps > 0 {
+		t.Fatalf("%d callbacks ran while another callback was running", overlaps)
+	}
+	if events == 0 {
+		t.Fatal("no events delivered")
+	}
+}
+
+// 回调panic后放弃剩余事件, 之后的事件正常触发
+func TestCallbackPanicDoesNotStall(t *testing.T) {
+	grid := NewGrid(30, 30, 10)
+	var log []string
+	panicked := false
+	grid.SetCallbacks(func(watcher, target EntityId) {
+		if !panicked {
+			panicked = true
+			panic("callback")
+		}
+		log = append(log, fmt.Sprintf("%d+%d", watcher, target))
+	}, nil)
+
+	if err := grid.Insert(1, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() { recover() }()
+		grid.Insert(2, 1, 1)
+	}()
+	if err := grid.Insert(3, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(log)
+	if fmt.Sprint(log) != "[1+3 2+3 3+1 3+2]" {
+		t.Fatalf("events after panic %v", log)
+	}
+}
+
+func BenchmarkMove(b *testing.B) {
+	const size, entities = 1000, 2000
+	grid := NewGrid(size, size, 20)
+	grid.SetCallbacks(func(watcher, target EntityId) {}, func(watcher, target EntityId) {})
+	r := rand.New(rand.NewSource(1))
+	pos := make([][2]int, entities)
+	for i := range pos {
+		pos[i] = [2]int{r.Intn(size), r.Intn(size)}
+		if err := grid.Insert(EntityId(i), pos[i][0], pos[i][1]); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := i % entities
+		p := &pos[id]
+		p[0], p[1] = clamp(p[0]+r.Intn(7)-3, size), clamp(p[1]+r.Intn(7)-3, size)
+		if err := grid.Move(EntityId(id), p[0], p[1]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
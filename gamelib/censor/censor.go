@@ -0,0 +1,296 @@
+package censor
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// 敏感词过滤(Aho-Corasick自动机).
+// Filter构建后只读,可以在多个goroutine中同时使用.
+
+// 默认忽略的字符: 空白和常见中英文标点
+const DefaultSkip = " \t\r\n!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~，。？；：“”‘’￥（）—、！…《》【】·"
+
+const DefaultMask = '*'
+
+const bomHead = '\uFEFF'
+
+type Options struct {
+	// 匹配时忽略的字符(e.g : "f*u*c*k"中的'*').
+	// 词库中出现的字符不会被忽略,因此可以放入字母和数字来过滤夹杂在中文里的干扰字符.
+	Skip string
+	Mask rune // 替换字符,为0时使用DefaultMask
+}
+
+type Match struct {
+	Word  string // 词库中的原词
+	Index int    // 词在词库中的下标
+	Start int    // 在原文中的起始位置(rune偏移,含)
+	End   int    // 在原文中的结束位置(rune偏移,不含)
+}
+
+type node struct {
+	next     map[rune]int32
+	fail     int32
+	word     int32 // 以该节点结尾的词,-1表示无
+	dictLink int32 // fail链上最近的有词节点,-1表示无
+}
+
+type Filter struct {
+	nodes   []node
+	words   []string // 原词
+	lengths []int    // 归一化后的词长(rune)
+	skip    map[rune]struct{}
+	mask    rune
+}
+
+// 全角转半角,大写转小写
+func Normalize(r rune) rune {
+	switch {
+	case r == '\u3000':
+		r = ' '
+	case r >= '！' && r <= '～':
+		r -= 0xFEE0
+	}
+	return unicode.ToLower(r)
+}
+
+func New(words []string, opts Options) *Filter {
+	filter, _ := build(words, opts)
+	return filter
+}
+
+// 构建自动机,同时返回每个输入词在Filter.words中的下标(空词为-1,重复词指向同一下标)
+func build(words []string, opts Options) (*Filter, []int) {
+	filter := &Filter{
+		nodes: []node{{fail: 0, word: -1, dictLink: -1}},
+		skip:  make(map[rune]struct{}),
+		mask:  opts.Mask,
+	}
+	if 0 == filter.mask {
+		filter.mask = DefaultMask
+	}
+
+	skip := make(map[rune]struct{})
+	for _, r := range opts.Skip {
+		skip[Normalize(r)] = struct{}{}
+	}
+
+	// 词归一化,词中出现的字符不忽略
+	alphabet := make(map[rune]struct{})
+	normalized := make([][]rune, 0, len(words))
+	for _, word := range words {
+		runes := make([]rune, 0, len(word))
+		for _, r := range strings.TrimSpace(word) {
+			if r == bomHead {
+				continue
+			}
+			r = Normalize(r)
+			runes = append(runes, r)
+			alphabet[r] = struct{}{}
+		}
+		normalized = append(normalized, runes)
+	}
+
+	for r := range skip {
+		if _, ok := alphabet[r]; !ok {
+			filter.skip[r] = struct{}{}
+		}
+	}
+
+	indexes := make([]int, len(words))
+	for i, runes := range normalized {
+		indexes[i] = -1
+		if len(runes) == 0 {
+			continue
+		}
+		indexes[i] = filter.insert(runes, words[i])
+	}
+	filter.buildFail()
+
+	return filter, indexes
+}
+
+func (filter *Filter) insert(runes []rune, word string) int {
+	cur := int32(0)
+	for _, r := range runes {
+		next, ok := filter.nodes[cur].next[r]
+		if !ok {
+			next = int32(len(filter.nodes))
+			filter.nodes = append(filter.nodes, node{word: -1, dictLink: -1})
+			if nil == filter.nodes[cur].next {
+				filter.nodes[cur].next = make(map[rune]int32)
+			}
+			filter.nodes[cur].next[r] = next
+		}
+		cur = next
+	}
+
+	if filter.nodes[cur].word >= 0 {
+		return int(filter.nodes[cur].word) // 重复的词
+	}
+	filter.nodes[cur].word = int32(len(filter.words))
+	filter.words = append(filter.words, strings.TrimSpace(word))
+	filter.lengths = append(filter.lengths, len(runes))
+	return len(filter.words) - 1
+}
+
+// 广度优先计算fail指针
+func (filter *Filter) buildFail() {
+	queue := make([]int32, 0, len(filter.nodes))
+	for _, child := range filter.nodes[0].next {
+		queue = append(queue, child)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for r, child := range filter.nodes[cur].next {
+			fail := filter.nodes[cur].fail
+			for {
+				if next, ok := filter.nodes[fail].next[r]; ok && next != child {
+					filter.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					filter.nodes[child].fail = 0
+					break
+				}
+				fail = filter.nodes[fail].fail
+			}
+
+			failNode := filter.nodes[filter.nodes[child].fail]
+			if failNode.word >= 0 {
+				filter.nodes[child].dictLink = filter.nodes[child].fail
+			} else {
+				filter.nodes[child].dictLink = failNode.dictLink
+			}
+			queue = append(queue, child)
+		}
+	}
+}
+
+// 从文件加载词库,每行一个词
+func LoadFile(path string, opts Options) (*Filter, error) {
+	words, err := ReadWords(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(words, opts), nil
+}
+
+// 读取词库文件,每行一个词,忽略空行
+func ReadWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), string(bomHead)))
+		if len(word) > 0 {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// 词库中的词数量
+func (filter *Filter) Len() int {
+	return len(filter.words)
+}
+
+func (filter *Filter) Words() []string {
+	return append([]string(nil), filter.words...)
+}
+
+// 查找所有匹配(包括重叠的匹配),按结束位置排序
+func (filter *Filter) FindAll(text string) []Match {
+	var matches []Match
+	filter.scan(text, func(match Match) bool {
+		matches = append(matches, match)
+		return true
+	})
+	return matches
+}
+
+// 是否包含敏感词
+func (filter *Filter) Contains(text string) bool {
+	found := false
+	filter.scan(text, func(Match) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// 将敏感词替换为mask(为0时使用构建时的Mask),匹配区间内被忽略的字符一并替换
+func (filter *Filter) Replace(text string, mask rune) (string, bool) {
+	matches := filter.FindAll(text)
+	if len(matches) == 0 {
+		return text, false
+	}
+	if 0 == mask {
+		mask = filter.mask
+	}
+	return MaskMatches(text, matches, mask), true
+}
+
+// 将matches覆盖的区间替换为mask
+func MaskMatches(text string, matches []Match, mask rune) string {
+	runes := []rune(text)
+	for _, match := range matches {
+		for i := match.Start; i < match.End && i < len(runes); i++ {
+			runes[i] = mask
+		}
+	}
+	return string(runes)
+}
+
+func (filter *Filter) scan(text string, visit func(Match) bool) {
+	if len(filter.words) == 0 {
+		return
+	}
+
+	var pos []int // 归一化字符在原文中的rune偏移
+	cur := int32(0)
+	index := 0
+	for _, raw := range text {
+		offset := index
+		index++
+
+		r := Normalize(raw)
+		if _, ok := filter.skip[r]; ok {
+			continue
+		}
+		pos = append(pos, offset)
+
+		for {
+			if next, ok := filter.nodes[cur].next[r]; ok {
+				cur = next
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = filter.nodes[cur].fail
+		}
+
+		for out := cur; out > 0; out = filter.nodes[out].dictLink {
+			word := filter.nodes[out].word
+			if word < 0 {
+				continue
+			}
+			start := pos[len(pos)-filter.lengths[word]]
+			if !visit(Match{Word: filter.words[word], Index: int(word), Start: start, End: offset + 1}) {
+				return
+			}
+		}
+	}
+}
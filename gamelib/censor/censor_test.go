@@ -0,0 +1,75 @@
+package censor
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFindAll(t *testing.T) {
+	filter := New([]string{"abc", "bc", "b", "FUCK", "c.d", "坏", "坏人", "", "bc"}, Options{Skip: DefaultSkip})
+	tests := []struct {
+		name string
+		text string
+		want string // Word[Start,End) 按结束位置排序
+	}{
+		{"overlapping", "abc", "[b[1,2) abc[0,3) bc[1,3)]"},
+		{"skip characters", "a b*c", "[b[2,3) abc[0,5) bc[2,5)]"},
+		{"full width", "ＡＢＣ", "[b[1,2) abc[0,3) bc[1,3)]"},
+		{"upper case", "Fuck", "[FUCK[0,4)]"},
+		{"full width space", "fu　ck", "[FUCK[0,5)]"},
+		{"skip character in word", "a.bc", "[b[2,3) bc[2,4)]"},
+		{"word with skip character", "c.d", "[c.d[0,3)]"},
+		{"chinese", "好坏人", "[坏[1,2) 坏人[1,3)]"},
+		{"no match", "hello", "[]"},
+	}
+	for _, test := range tests {
+		got := make([]string, 0)
+		for _, match := range filter.FindAll(test.text) {
+			got = append(got, fmt.Sprintf("%s[%d,%d)", match.Word, match.Start, match.End))
+		}
+		if fmt.Sprint(got) != test.want {
+			t.Errorf("%s : FindAll(%q) = %v, want %s", test.name, test.text, got, test.want)
+		}
+		if contains := filter.Contains(test.text); contains != (test.want != "[]") {
+			t.Errorf("%s : Contains(%q) = %v", test.name, test.text, contains)
+		}
+	}
+
+	// 空词和重复的词不计入词库
+	if filter.Len() != 7 {
+		t.Errorf("Len = %d, want 7", filter.Len())
+	}
+	if New(nil, Options{}).Contains("abc") {
+		t.Error("empty filter should not match")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	filter := New([]string{"abc", "fuck"}, Options{Skip: DefaultSkip, Mask: '#'})
+	tests := []struct {
+		text     string
+		mask     rune
+		want     string
+		replaced bool
+	}{
+		{"xabcx", 0, "x###x", true},
+		{"a b*c!", 0, "#####!", true},
+		{"ＦＵＣＫ off", '*', "**** off", true},
+		{"hello", 0, "hello", false},
+	}
+	for _, test := range tests {
+		got, replaced := filter.Replace(test.text, test.mask)
+		if got != test.want || replaced != test.replaced {
+			t.Errorf("Replace(%q) = %q %v, want %q %v", test.text, got, replaced, test.want, test.replaced)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[rune]rune{'Ａ': 'a', 'ｚ': 'z', '０': '0', '！': '!', '　': ' ', 'A': 'a', '中': '中'}
+	for r, want := range tests {
+		if got := Normalize(r); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", r, got, want)
+		}
+	}
+}
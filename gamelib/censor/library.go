@@ -0,0 +1,323 @@
+package censor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 分类词库目录结构:
+//   <category>.txt : 分类词库,每行一个词,文件名即分类名
+//   allow.txt      : 白名单,敏感词完全落在白名单词内时不处理(e.g : "习惯"中的"习")
+//   censor.json    : 分类和策略配置,可选
+//
+// censor.json示例:
+//   {
+//     "skip" : " *",
+//     "mask" : "*",
+//     "categories" : { "politics" : "block", "ads" : "flag", "profanity" : "mask" },
+//     "policies" : {
+//       "chat"  : { "politics" : "block", "ads" : "flag", "*" : "mask" },
+//       "name"  : { "*" : "block" },
+//       "guild" : { "*" : "block" }
+//     }
+//   }
+// 策略中未列出的分类使用"*",没有"*"时使用分类的默认处理方式.
+
+const (
+	AllowFileName = "allow.txt"
+	MetaFileName  = "censor.json"
+)
+
+// 处理方式,数值越大越严格,多个分类命中时取最严格的
+type Action int
+
+const (
+	ActionPass  Action = iota // 放行
+	ActionFlag                // 放行,标记待审核
+	ActionMask                // 替换敏感词后放行
+	ActionBlock               // 拒绝
+)
+
+var actionNames = map[string]Action{
+	"pass":  ActionPass,
+	"flag":  ActionFlag,
+	"mask":  ActionMask,
+	"block": ActionBlock,
+}
+
+func (action Action) String() string {
+	for name, v := range actionNames {
+		if v == action {
+			return name
+		}
+	}
+	return fmt.Sprintf("Action(%d)", int(action))
+}
+
+func (action *Action) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	v, ok := actionNames[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown censor action %q", name)
+	}
+	*action = v
+	return nil
+}
+
+// 分类 -> 处理方式, "*"为默认
+type Policy map[string]Action
+
+type Meta struct {
+	Skip       string            `json:"skip"`
+	Mask       string            `json:"mask"`
+	Categories map[string]Action `json:"categories"` // 分类默认处理方式,未配置为block
+	Policies   map[string]Policy `json:"policies"`
+}
+
+type Verdict struct {
+	Action     Action
+	Categories []string // 命中的分类(已排序)
+	Matches    []Match  // 命中的敏感词(已去除白名单)
+	Text       string   // Action为ActionMask时为替换后的文本,否则为原文
+}
+
+type Library struct {
+	filter      *Filter
+	allow       *Filter
+	categories  []string // 分类名
+	defaults    []Action // 分类默认处理方式
+	wordCats    [][]int  // filter词下标 -> 分类下标(一个词可以属于多个分类)
+	policies    map[string]Policy
+	mask        rune
+	categoryIdx map[string]int
+}
+
+// lists : 分类 -> 词
+func NewLibrary(lists map[string][]string, allow []string, meta Meta) (*Library, error) {
+	opts := Options{Skip: meta.Skip}
+	if len(opts.Skip) == 0 {
+		opts.Skip = DefaultSkip
+	}
+	for _, r := range meta.Mask {
+		opts.Mask = r
+		break
+	}
+
+	lib := &Library{
+		policies:    meta.Policies,
+		categoryIdx: make(map[string]int),
+	}
+
+	var words []string
+	var wordCategory []int
+	for _, name := range sortedKeys(lists) {
+		idx := len(lib.categories)
+		lib.categoryIdx[name] = idx
+		lib.categories = append(lib.categories, name)
+
+		action, ok := meta.Categories[name]
+		if !ok {
+			action = ActionBlock
+		}
+		lib.defaults = append(lib.defaults, action)
+
+		for _, word := range lists[name] {
+			words = append(words, word)
+			wordCategory = append(wordCategory, idx)
+		}
+	}
+
+	var indexes []int
+	lib.filter, indexes = build(words, opts)
+	lib.mask = lib.filter.mask
+	lib.wordCats = make([][]int, lib.filter.Len())
+	for i, idx := range indexes {
+		if idx < 0 {
+			continue
+		}
+		if !containsInt(lib.wordCats[idx], wordCategory[i]) {
+			lib.wordCats[idx] = append(lib.wordCats[idx], wordCategory[i])
+		}
+	}
+
+	lib.allow = New(allow, opts)
+	return lib, lib.validate(meta)
+}
+
+// 配置中引用的分类必须存在
+func (lib *Library) validate(meta Meta) error {
+	for name := range meta.Categories {
+		if _, ok := lib.categoryIdx[name]; !ok {
+			return fmt.Errorf("censor category %q has no word list", name)
+		}
+	}
+	for policy, rules := range meta.Policies {
+		for name := range rules {
+			if _, ok := lib.categoryIdx[name]; !ok && name != "*" {
+				return fmt.Errorf("censor policy %q references unknown category %q", policy, name)
+			}
+		}
+	}
+	return nil
+}
+
+// 加载分类词库目录
+func LoadDir(dir string) (*Library, error) {
+	var meta Meta
+	if b, err := ioutil.ReadFile(filepath.Join(dir, MetaFileName)); err == nil {
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return nil, fmt.Errorf("%s : %w", MetaFileName, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make(map[string][]string)
+	var allow []string
+	for _, file := range files {
+		words, err := ReadWords(file)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(file)
+		if name == AllowFileName {
+			allow = words
+			continue
+		}
+		lists[strings.TrimSuffix(name, ".txt")] = words
+	}
+
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("no word list found in %s", dir)
+	}
+
+	return NewLibrary(lists, allow, meta)
+}
+
+// 单个词库文件作为一个分类(兼容filtertext.txt)
+func LoadSingle(path string, category string, meta Meta) (*Library, error) {
+	words, err := ReadWords(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewLibrary(map[string][]string{category: words}, nil, meta)
+}
+
+// 所有分类的敏感词(不含白名单)
+func (lib *Library) Filter() *Filter {
+	return lib.filter
+}
+
+func (lib *Library) Categories() []string {
+	return append([]string(nil), lib.categories...)
+}
+
+// 按策略检查文本,policy为空时使用分类默认处理方式
+func (lib *Library) Check(policy string, text string) (Verdict, error) {
+	verdict := Verdict{Text: text}
+
+	var rules Policy
+	if len(policy) > 0 {
+		var ok bool
+		if rules, ok = lib.policies[policy]; !ok {
+			return verdict, fmt.Errorf("unknown censor policy %q", policy)
+		}
+	}
+
+	matches := lib.filter.FindAll(text)
+	if len(matches) == 0 {
+		return verdict, nil
+	}
+
+	allowed := lib.allow.FindAll(text)
+	hit := make(map[int]struct{})
+	var masked []Match
+	for _, match := range matches {
+		if coveredBy(match, allowed) {
+			continue
+		}
+
+		matchAction := ActionPass
+		for _, category := range lib.wordCats[match.Index] {
+			action := lib.action(rules, category)
+			if action == ActionPass {
+				continue
+			}
+			if _, ok := hit[category]; !ok {
+				hit[category] = struct{}{}
+				verdict.Categories = append(verdict.Categories, lib.categories[category])
+			}
+			if action > matchAction {
+				matchAction = action
+			}
+		}
+
+		if matchAction == ActionPass {
+			continue
+		}
+		if matchAction > verdict.Action {
+			verdict.Action = matchAction
+		}
+		if matchAction >= ActionMask {
+			masked = append(masked, match)
+		}
+		verdict.Matches = append(verdict.Matches, match)
+	}
+
+	sort.Strings(verdict.Categories)
+	if verdict.Action == ActionMask {
+		verdict.Text = MaskMatches(text, masked, lib.mask)
+	}
+	return verdict, nil
+}
+
+func (lib *Library) action(rules Policy, category int) Action {
+	if action, ok := rules[lib.categories[category]]; ok {
+		return action
+	}
+	if action, ok := rules["*"]; ok {
+		return action
+	}
+	return lib.defaults[category]
+}
+
+// 敏感词是否完全落在某个白名单词内
+func coveredBy(match Match, allowed []Match) bool {
+	for _, allow := range allowed {
+		if allow.Start <= match.Start && match.End <= allow.End {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, v int) bool {
+	for _, elem := range list {
+		if elem == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(lists map[string][]string) []string {
+	keys := make([]string, 0, len(lists))
+	for k := range lists {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,126 @@
+package censor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func newTestLibrary(t *testing.T) *Library {
+	t.Helper()
+	lib, err := NewLibrary(map[string][]string{
+		"politics":  {"坏人"},
+		"ads":       {"加微信", "ass"},
+		"profanity": {"ass", "fuck"},
+	}, []string{"class", "好坏人"}, Meta{
+		Mask:       "#",
+		Categories: map[string]Action{"politics": ActionBlock, "ads": ActionFlag, "profanity": ActionMask},
+		Policies: map[string]Policy{
+			"chat":    {"politics": ActionBlock, "ads": ActionFlag, "*": ActionMask},
+			"name":    {"*": ActionBlock},
+			"lenient": {"ads": ActionPass},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lib
+}
+
+func TestLibraryCheck(t *testing.T) {
+	lib := newTestLibrary(t)
+	tests := []struct {
+		policy     string
+		text       string
+		action     Action
+		categories string
+		out        string
+	}{
+		{"", "hello", ActionPass, "[]", "hello"},
+		{"", "you fuck", ActionMask, "[profanity]", "you ####"},
+		{"", "加 微 信", ActionFlag, "[ads]", "加 微 信"},
+		// 一个词属于多个分类时取最严格的处理方式
+		{"", "ass", ActionMask, "[ads profanity]", "###"},
+		{"", "坏人 fuck", ActionBlock, "[politics profanity]", "坏人 fuck"},
+		// 白名单
+		{"", "my class", ActionPass, "[]", "my class"},
+		{"", "他是好坏人", ActionPass, "[]", "他是好坏人"},
+		{"", "class ass", ActionMask, "[ads profanity]", "class ###"},
+		// 策略
+		{"chat", "加微信 fuck", ActionMask, "[ads profanity]", "加微信 ####"},
+		{"name", "加微信", ActionBlock, "[ads]", "加微信"},
+		{"lenient", "加微信", ActionPass, "[]", "加微信"},
+		{"lenient", "ass", ActionMask, "[profanity]", "###"},
+	}
+	for _, test := range tests {
+		verdict, err := lib.Check(test.policy, test.text)
+		if err != nil {
+			t.Fatalf("Check(%q, %q) : %v", test.policy, test.text, err)
+		}
+		categories := fmt.Sprint(verdict.Categories)
+		if verdict.Categories == nil {
+			categories = "[]"
+		}
+		if verdict.Action != test.action || categories != test.categories || verdict.Text != test.out {
+			t.Errorf("Check(%q, %q) = %s %s %q, want %s %s %q", test.policy, test.text,
+				verdict.Action, categories, verdict.Text, test.action, test.categories, test.out)
+		}
+	}
+
+	if _, err := lib.Check("unknown", "hello"); nil == err {
+		t.Error("unknown policy should fail")
+	}
+}
+
+func TestLibraryValidate(t *testing.T) {
+	lists := map[string][]string{"ads": {"加微信"}}
+	if _, err := NewLibrary(lists, nil, Meta{Categories: map[string]Action{"politics": ActionBlock}}); nil == err {
+		t.Error("category without word list should fail")
+	}
+	if _, err := NewLibrary(lists, nil, Meta{Policies: map[string]Policy{"chat": {"politics": ActionMask}}}); nil == err {
+		t.Error("policy with unknown category should fail")
+	}
+	if _, err := NewLibrary(lists, nil, Meta{Policies: map[string]Policy{"chat": {"*": ActionMask}}}); err != nil {
+		t.Errorf("policy with default rule : %v", err)
+	}
+}
+
+func writeWords(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeWords(t, dir, map[string]string{
+		"ads.txt":    "\ufeff加微信\n\n  代练  \n",
+		"allow.txt":  "代练赛",
+		MetaFileName: `{"categories" : {"ads" : "Flag"}, "policies" : {"name" : {"*" : "block"}}}`,
+	})
+	lib, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(lib.Categories()) != "[ads]" || fmt.Sprint(lib.Filter().Words()) != "[加微信 代练]" {
+		t.Fatalf("categories %v words %v", lib.Categories(), lib.Filter().Words())
+	}
+	if verdict, _ := lib.Check("", "代练"); verdict.Action != ActionFlag {
+		t.Errorf("default action %s, want flag", verdict.Action)
+	}
+	if verdict, _ := lib.Check("name", "代练赛"); verdict.Action != ActionPass {
+		t.Errorf("allowed word action %s, want pass", verdict.Action)
+	}
+
+	writeWords(t, dir, map[string]string{MetaFileName: `{"categories" : {"ads" : "drop"}}`})
+	if _, err := LoadDir(dir); nil == err {
+		t.Error("unknown action should fail")
+	}
+	if _, err := LoadDir(t.TempDir()); nil == err {
+		t.Error("dir without word list should fail")
+	}
+}
@@ -0,0 +1,170 @@
+package censor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 词库热更新: 新词库在旁边构建完成后原子替换,正在使用旧词库的检查不受影响.
+
+type ReloadStats struct {
+	Time       time.Time     // 加载完成时间
+	Words      int           // 词数量(各分类合计,不含白名单)
+	Categories int           // 分类数量
+	BuildTime  time.Duration // 读取和构建耗时
+	Added      []string      // 新增的词("分类:词")
+	Removed    []string      // 删除的词("分类:词")
+}
+
+func (stats ReloadStats) String() string {
+	return fmt.Sprintf("%d words in %d categories, build %s, added %d, removed %d",
+		stats.Words, stats.Categories, stats.BuildTime, len(stats.Added), len(stats.Removed))
+}
+
+type Store struct {
+	path  string                   // 词库目录或文件,用于检测变化
+	load  func() (*Library, error) // 加载方法
+	value atomic.Value             // *Library
+
+	lock      sync.Mutex // 串行化Reload
+	stats     ReloadStats
+	signature string // 词库文件的大小和修改时间,用于Watch检测变化
+}
+
+// path为词库目录或文件, load负责从path构建词库
+func NewStore(path string, load func() (*Library, error)) (*Store, error) {
+	store := &Store{path: path, load: load}
+	if _, err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// 当前词库
+func (store *Store) Library() *Library {
+	return store.value.Load().(*Library)
+}
+
+// 最近一次成功加载的统计
+func (store *Store) Stats() ReloadStats {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.stats
+}
+
+// 重新加载词库,失败时保留旧词库
+func (store *Store) Reload() (ReloadStats, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	signature, _ := fileSignature(store.path)
+
+	startTime := time.Now()
+	lib, err := store.load()
+	if err != nil {
+		return ReloadStats{}, err
+	}
+
+	stats := ReloadStats{
+		Time:       time.Now(),
+		Words:      lib.filter.Len(),
+		Categories: len(lib.categories),
+		BuildTime:  time.Since(startTime),
+	}
+	if old, ok := store.value.Load().(*Library); ok {
+		stats.Added, stats.Removed = diffWords(old.entries(), lib.entries())
+	}
+
+	store.value.Store(lib)
+	store.stats = stats
+	store.signature = signature
+	return stats, nil
+}
+
+// 定时检查词库文件变化,变化时自动Reload. 返回停止函数.
+func (store *Store) Watch(interval time.Duration, onReload func(ReloadStats, error)) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			signature, err := fileSignature(store.path)
+			store.lock.Lock()
+			changed := err == nil && signature != store.signature
+			store.lock.Unlock()
+			if !changed {
+				continue
+			}
+
+			stats, err := store.Reload()
+			if onReload != nil {
+				onReload(stats, err)
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// 所有"分类:词"
+func (lib *Library) entries() map[string]struct{} {
+	entries := make(map[string]struct{}, len(lib.wordCats))
+	for idx, categories := range lib.wordCats {
+		for _, category := range categories {
+			entries[lib.categories[category]+":"+lib.filter.words[idx]] = struct{}{}
+		}
+	}
+	return entries
+}
+
+func diffWords(old, cur map[string]struct{}) (added []string, removed []string) {
+	for entry := range cur {
+		if _, ok := old[entry]; !ok {
+			added = append(added, entry)
+		}
+	}
+	for entry := range old {
+		if _, ok := cur[entry]; !ok {
+			removed = append(removed, entry)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// 文件(或目录下所有文件)的名称,大小和修改时间
+func fileSignature(path string) (string, error) {
+	f, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !f.IsDir() {
+		return fmt.Sprintf("%d:%d", f.Size(), f.ModTime().UnixNano()), nil
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+	signature := ""
+	for _, file := range files {
+		signature += fmt.Sprintf("%s:%d:%d;", file.Name(), file.Size(), file.ModTime().UnixNano())
+	}
+	return signature, nil
+}
@@ -0,0 +1,95 @@
+package censor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeWords(t, dir, map[string]string{"ads.txt": "加微信\n代练\n"})
+	store, err := NewStore(dir, func() (*Library, error) { return LoadDir(dir) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+// 修改文件内容和修改时间, 保证签名变化
+func touchWords(t *testing.T, dir string, name string, content string, modTime time.Time) {
+	t.Helper()
+	writeWords(t, dir, map[string]string{name: content})
+	if err := os.Chtimes(filepath.Join(dir, name), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	store, dir := newTestStore(t)
+	old := store.Library()
+	if stats := store.Stats(); stats.Words != 2 || stats.Categories != 1 || len(stats.Added) != 0 {
+		t.Fatalf("initial stats %+v", stats)
+	}
+
+	touchWords(t, dir, "ads.txt", "加微信\n刷钻\n", time.Now().Add(time.Hour))
+	touchWords(t, dir, "politics.txt", "坏人\n", time.Now().Add(time.Hour))
+	stats, err := store.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(stats.Added, stats.Removed); got != "[ads:刷钻 politics:坏人] [ads:代练]" {
+		t.Fatalf("added and removed %s", got)
+	}
+	if store.Library() == old || !store.Library().Filter().Contains("刷钻") || store.Library().Filter().Contains("代练") {
+		t.Fatal("Reload did not replace the library")
+	}
+	// 旧词库仍可使用
+	if !old.Filter().Contains("代练") {
+		t.Fatal("old library changed after Reload")
+	}
+
+	// 加载失败时保留当前词库和统计
+	cur := store.Library()
+	touchWords(t, dir, MetaFileName, "{", time.Now().Add(2*time.Hour))
+	if _, err := store.Reload(); nil == err {
+		t.Fatal("Reload with broken censor.json should fail")
+	}
+	if store.Library() != cur || store.Stats().Words != 3 {
+		t.Fatalf("failed Reload replaced the library, stats %+v", store.Stats())
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	store, dir := newTestStore(t)
+	reloaded := make(chan ReloadStats, 10)
+	stop := store.Watch(5*time.Millisecond, func(stats ReloadStats, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		reloaded <- stats
+	})
+	defer stop()
+
+	touchWords(t, dir, "ads.txt", "加微信\n代练\n刷钻\n", time.Now().Add(time.Hour))
+	select {
+	case stats := <-reloaded:
+		if fmt.Sprint(stats.Added) != "[ads:刷钻]" {
+			t.Fatalf("added %v", stats.Added)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not reload after the word list changed")
+	}
+
+	// 未变化时不重复加载
+	select {
+	case stats := <-reloaded:
+		t.Fatalf("unexpected reload %+v", stats)
+	case <-time.After(50 * time.Millisecond):
+	}
+	stop()
+	stop()
+}
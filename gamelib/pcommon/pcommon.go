@@ -3,6 +3,8 @@ package pcommon
 import (
 	"fmt"
 	"runtime"
+	"sync"
+	"time"
 )
 
 // see: https://golang.org/pkg/runtime/#MemStats
@@ -21,6 +23,74 @@ func PrintMemStats(head string) uint64 {
 	return bToMb(stats.Alloc)
 }
 
+// 定时采样内存,记录峰值(用于统计加载表格等阶段的内存峰值)
+type MemSampler struct {
+	lock     sync.Mutex
+	peak     uint64 // 峰值HeapAlloc(字节)
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// interval越小越准确,ReadMemStats会短暂STW,不宜小于1ms
+func StartMemSampler(interval time.Duration) *MemSampler {
+	sampler := &MemSampler{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	sampler.sample()
+
+	go func() {
+		defer close(sampler.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sampler.stop:
+				return
+			case <-ticker.C:
+				sampler.sample()
+			}
+		}
+	}()
+
+	return sampler
+}
+
+func (sampler *MemSampler) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	sampler.lock.Lock()
+	if stats.HeapAlloc > sampler.peak {
+		sampler.peak = stats.HeapAlloc
+	}
+	sampler.lock.Unlock()
+}
+
+// 停止采样,返回峰值(字节)
+func (sampler *MemSampler) Stop() uint64 {
+	sampler.stopOnce.Do(func() {
+		close(sampler.stop)
+		<-sampler.done
+		sampler.sample()
+	})
+	return sampler.Peak()
+}
+
+func (sampler *MemSampler) Peak() uint64 {
+	sampler.lock.Lock()
+	defer sampler.lock.Unlock()
+	return sampler.peak
+}
+
+// 打印峰值和当前内存, 返回峰值(MiB)
+func PrintPeakMemStats(head string, sampler *MemSampler) uint64 {
+	peak := bToMb(sampler.Stop())
+	fmt.Printf("PrintPeakMemStats Memory %s peak HeapAlloc = %v MiB\n", head, peak)
+	PrintMemStats(head)
+	return peak
+}
+
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
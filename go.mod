@@ -3,6 +3,6 @@ module parser
 go 1.18
 
 require (
-	github.com/kai1987/go-text-censor v0.0.0-20180118163317-7afb6c25ec65
 	github.com/tealeg/xlsx v1.0.5
+	golang.org/x/text v0.14.0
 )
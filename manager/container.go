@@ -1,11 +1,16 @@
 package manager
 
 import (
+	"context"
 	"fmt"
 	"parser/gamedb"
 	"parser/util"
+	"time"
 )
 
+// 加载配置超时(配置目录可能在网络共享上)
+const loadTimeout = 10 * time.Minute
+
 var gameDB *gamedb.GameDB
 
 func GameDB() *gamedb.GameDB {
@@ -34,7 +39,10 @@ func GetContainer() *Container {
 func (container *Container) Init() error {
 	var err error
 	var basePath string = "./Configs"
-	if gameDB, err = gamedb.Load(basePath); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	// 包级GetSceneMap/LoadSceneMapById使用LoadContext加载的GameDB
+	if gameDB, err = gamedb.LoadContext(ctx, basePath, gamedb.DefaultLoadOptions()); err != nil {
 		return err
 	}
 	container.initModules()